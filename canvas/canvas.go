@@ -0,0 +1,265 @@
+// Package canvas builds Canvas 2D drawing ops for waveapp canvases.
+//
+// Instead of queueing vdom.VDomRefOperation values with hand written op
+// names, a Canvas2D collects typed calls (BeginPath, MoveTo, FillText, ...)
+// for a frame and Flush queues them all on the canvas ref. Op names only
+// exist as constants of an unexported type, so a misspelled op does not
+// compile. Ops returns the recorded stream, to inspect what a frame draws.
+package canvas
+
+import (
+	"context"
+	"math"
+
+	"github.com/wavetermdev/waveterm/pkg/vdom"
+)
+
+// opName is a method or property of CanvasRenderingContext2D
+type opName string
+
+const (
+	opClearRect      opName = "clearRect"
+	opFillRect       opName = "fillRect"
+	opStrokeRect     opName = "strokeRect"
+	opBeginPath      opName = "beginPath"
+	opClosePath      opName = "closePath"
+	opMoveTo         opName = "moveTo"
+	opLineTo         opName = "lineTo"
+	opArc            opName = "arc"
+	opRect           opName = "rect"
+	opStroke         opName = "stroke"
+	opFill           opName = "fill"
+	opFillText       opName = "fillText"
+	opStrokeText     opName = "strokeText"
+	opSave           opName = "save"
+	opRestore        opName = "restore"
+	opTranslate      opName = "translate"
+	opRotate         opName = "rotate"
+	opScale          opName = "scale"
+	opSetTransform   opName = "setTransform"
+	opResetTransform opName = "resetTransform"
+	opSetLineDash    opName = "setLineDash"
+
+	// properties, set with a single param
+	opFillStyle    opName = "fillStyle"
+	opStrokeStyle  opName = "strokeStyle"
+	opLineWidth    opName = "lineWidth"
+	opFont         opName = "font"
+	opTextAlign    opName = "textAlign"
+	opTextBaseline opName = "textBaseline"
+	opGlobalAlpha  opName = "globalAlpha"
+)
+
+type TextAlign string
+
+const (
+	AlignLeft   TextAlign = "left"
+	AlignRight  TextAlign = "right"
+	AlignCenter TextAlign = "center"
+	AlignStart  TextAlign = "start"
+	AlignEnd    TextAlign = "end"
+)
+
+type TextBaseline string
+
+const (
+	BaselineTop        TextBaseline = "top"
+	BaselineMiddle     TextBaseline = "middle"
+	BaselineAlphabetic TextBaseline = "alphabetic"
+	BaselineBottom     TextBaseline = "bottom"
+)
+
+// Canvas2D records the ops of one frame. Setting a property to the value
+// it already has is skipped, so draw code can set styles freely.
+type Canvas2D struct {
+	ops   []vdom.VDomRefOperation
+	props map[opName]any   // current property values
+	saved []map[opName]any // property values at each Save
+}
+
+func New() *Canvas2D {
+	return &Canvas2D{props: make(map[opName]any)}
+}
+
+func (c *Canvas2D) add(op opName, params ...any) *Canvas2D {
+	c.ops = append(c.ops, vdom.VDomRefOperation{Op: string(op), Params: params})
+	return c
+}
+
+func (c *Canvas2D) setProp(op opName, val any) *Canvas2D {
+	if cur, ok := c.props[op]; ok && cur == val {
+		return c
+	}
+	c.props[op] = val
+	return c.add(op, val)
+}
+
+// Ops returns the ops recorded since the last Flush
+func (c *Canvas2D) Ops() []vdom.VDomRefOperation {
+	return c.ops
+}
+
+func (c *Canvas2D) Len() int {
+	return len(c.ops)
+}
+
+// Flush queues the recorded ops on ref and starts a new frame. Nothing is
+// queued while the canvas is not mounted.
+func (c *Canvas2D) Flush(ctx context.Context, ref *vdom.VDomRef) {
+	for _, op := range c.ops {
+		vdom.QueueRefOp(ctx, ref, op)
+	}
+	c.Reset()
+}
+
+// Reset drops the recorded ops. The canvas may be remounted or resized
+// between frames (which resets its state), so property values are
+// forgotten too.
+func (c *Canvas2D) Reset() {
+	c.ops = nil
+	c.props = make(map[opName]any)
+	c.saved = nil
+}
+
+func (c *Canvas2D) ClearRect(x, y, w, h float64) *Canvas2D {
+	return c.add(opClearRect, x, y, w, h)
+}
+
+func (c *Canvas2D) FillRect(x, y, w, h float64) *Canvas2D {
+	return c.add(opFillRect, x, y, w, h)
+}
+
+func (c *Canvas2D) StrokeRect(x, y, w, h float64) *Canvas2D {
+	return c.add(opStrokeRect, x, y, w, h)
+}
+
+func (c *Canvas2D) BeginPath() *Canvas2D {
+	return c.add(opBeginPath)
+}
+
+func (c *Canvas2D) ClosePath() *Canvas2D {
+	return c.add(opClosePath)
+}
+
+func (c *Canvas2D) MoveTo(x, y float64) *Canvas2D {
+	return c.add(opMoveTo, x, y)
+}
+
+func (c *Canvas2D) LineTo(x, y float64) *Canvas2D {
+	return c.add(opLineTo, x, y)
+}
+
+// Arc adds an arc around x,y from start to end (radians)
+func (c *Canvas2D) Arc(x, y, radius, start, end float64) *Canvas2D {
+	return c.add(opArc, x, y, radius, start, end)
+}
+
+func (c *Canvas2D) Rect(x, y, w, h float64) *Canvas2D {
+	return c.add(opRect, x, y, w, h)
+}
+
+func (c *Canvas2D) Stroke() *Canvas2D {
+	return c.add(opStroke)
+}
+
+func (c *Canvas2D) Fill() *Canvas2D {
+	return c.add(opFill)
+}
+
+func (c *Canvas2D) FillText(text string, x, y float64) *Canvas2D {
+	return c.add(opFillText, text, x, y)
+}
+
+func (c *Canvas2D) StrokeText(text string, x, y float64) *Canvas2D {
+	return c.add(opStrokeText, text, x, y)
+}
+
+// Save pushes the canvas state, Restore pops it
+func (c *Canvas2D) Save() *Canvas2D {
+	saved := make(map[opName]any, len(c.props))
+	for k, v := range c.props {
+		saved[k] = v
+	}
+	c.saved = append(c.saved, saved)
+	return c.add(opSave)
+}
+
+func (c *Canvas2D) Restore() *Canvas2D {
+	if len(c.saved) > 0 {
+		c.props = c.saved[len(c.saved)-1]
+		c.saved = c.saved[:len(c.saved)-1]
+	} else {
+		// unbalanced restore, the canvas state is unknown now
+		c.props = make(map[opName]any)
+	}
+	return c.add(opRestore)
+}
+
+func (c *Canvas2D) Translate(x, y float64) *Canvas2D {
+	return c.add(opTranslate, x, y)
+}
+
+// Rotate rotates by angle radians, clockwise
+func (c *Canvas2D) Rotate(angle float64) *Canvas2D {
+	return c.add(opRotate, angle)
+}
+
+func (c *Canvas2D) Scale(x, y float64) *Canvas2D {
+	return c.add(opScale, x, y)
+}
+
+// SetTransform replaces the transform with the matrix a b c d e f
+func (c *Canvas2D) SetTransform(a, b, cc, d, e, f float64) *Canvas2D {
+	return c.add(opSetTransform, a, b, cc, d, e, f)
+}
+
+func (c *Canvas2D) ResetTransform() *Canvas2D {
+	return c.add(opResetTransform)
+}
+
+// SetLineDash sets the dash pattern, no segments means solid lines
+func (c *Canvas2D) SetLineDash(segments ...float64) *Canvas2D {
+	if segments == nil {
+		segments = []float64{}
+	}
+	return c.add(opSetLineDash, segments)
+}
+
+func (c *Canvas2D) FillStyle(style string) *Canvas2D {
+	return c.setProp(opFillStyle, style)
+}
+
+func (c *Canvas2D) StrokeStyle(style string) *Canvas2D {
+	return c.setProp(opStrokeStyle, style)
+}
+
+func (c *Canvas2D) LineWidth(width float64) *Canvas2D {
+	return c.setProp(opLineWidth, width)
+}
+
+// Font sets the CSS font, like "11px monospace"
+func (c *Canvas2D) Font(font string) *Canvas2D {
+	return c.setProp(opFont, font)
+}
+
+func (c *Canvas2D) TextAlign(align TextAlign) *Canvas2D {
+	return c.setProp(opTextAlign, string(align))
+}
+
+func (c *Canvas2D) TextBaseline(baseline TextBaseline) *Canvas2D {
+	return c.setProp(opTextBaseline, string(baseline))
+}
+
+func (c *Canvas2D) GlobalAlpha(alpha float64) *Canvas2D {
+	return c.setProp(opGlobalAlpha, alpha)
+}
+
+// Line strokes a single segment as its own path
+func (c *Canvas2D) Line(x1, y1, x2, y2 float64) *Canvas2D {
+	return c.BeginPath().MoveTo(x1, y1).LineTo(x2, y2).Stroke()
+}
+
+// Circle fills a circle as its own path
+func (c *Canvas2D) Circle(x, y, radius float64) *Canvas2D {
+	return c.BeginPath().Arc(x, y, radius, 0, 2*math.Pi).Fill()
+}
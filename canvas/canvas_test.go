@@ -0,0 +1,112 @@
+package canvas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/vdom"
+)
+
+// opNames returns the op names of the recorded stream
+func opNames(c *Canvas2D) []string {
+	var rtn []string
+	for _, op := range c.Ops() {
+		rtn = append(rtn, op.Op)
+	}
+	return rtn
+}
+
+func TestDrawOps(t *testing.T) {
+	c := New()
+	c.BeginPath().MoveTo(1, 2).LineTo(3, 4).Stroke()
+	c.FillText("hi", 5, 6)
+
+	want := []vdom.VDomRefOperation{
+		{Op: "beginPath", Params: []any{}},
+		{Op: "moveTo", Params: []any{1.0, 2.0}},
+		{Op: "lineTo", Params: []any{3.0, 4.0}},
+		{Op: "stroke", Params: []any{}},
+		{Op: "fillText", Params: []any{"hi", 5.0, 6.0}},
+	}
+	got := c.Ops()
+	if len(got) != len(want) {
+		t.Fatalf("got %d ops, want %d: %v", len(got), len(want), opNames(c))
+	}
+	for idx := range want {
+		if got[idx].Op != want[idx].Op || len(got[idx].Params) != len(want[idx].Params) {
+			t.Fatalf("op %d: got %v, want %v", idx, got[idx], want[idx])
+		}
+		for pidx := range want[idx].Params {
+			if got[idx].Params[pidx] != want[idx].Params[pidx] {
+				t.Errorf("op %d param %d: got %v, want %v", idx, pidx, got[idx].Params[pidx], want[idx].Params[pidx])
+			}
+		}
+	}
+}
+
+func TestStyleDedup(t *testing.T) {
+	c := New()
+	c.FillStyle("red").FillStyle("red").LineWidth(2).LineWidth(2)
+	c.TextAlign(AlignCenter).TextAlign(AlignCenter)
+	c.FillStyle("blue").FillStyle("red")
+
+	want := []string{"fillStyle", "lineWidth", "textAlign", "fillStyle", "fillStyle"}
+	if got := opNames(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	c := New()
+	c.FillStyle("red")
+	c.Save().FillStyle("blue").Translate(10, 10).Restore()
+	// restored to red, so setting red again is a no-op
+	c.FillStyle("red")
+	// blue is no longer current after the restore
+	c.FillStyle("blue")
+
+	want := []string{"fillStyle", "save", "fillStyle", "translate", "restore", "fillStyle"}
+	if got := opNames(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestUnbalancedRestore(t *testing.T) {
+	c := New()
+	c.FillStyle("red").Restore().FillStyle("red")
+
+	// the state after a restore without save is unknown, so red is set again
+	want := []string{"fillStyle", "restore", "fillStyle"}
+	if got := opNames(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := New()
+	c.FillStyle("red").Save().ClearRect(0, 0, 10, 10)
+	c.Reset()
+	if c.Len() != 0 {
+		t.Fatalf("got %d ops after Reset, want 0", c.Len())
+	}
+	// property values are forgotten too
+	c.FillStyle("red")
+	if got, want := opNames(c), []string{"fillStyle"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFlushEmpties(t *testing.T) {
+	c := New()
+	c.StrokeStyle("#333").Line(0, 0, 1, 1)
+	// an unmounted ref queues nothing, the buffer is emptied all the same
+	c.Flush(context.Background(), &vdom.VDomRef{})
+	if c.Len() != 0 {
+		t.Fatalf("got %d ops after Flush, want 0", c.Len())
+	}
+	c.StrokeStyle("#333")
+	if got, want := opNames(c), []string{"strokeStyle"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	backupSuffix     = ".bak"
+	backupTimeFormat = "20060102-150405.000"
+	backupSeqSep     = "_"
+)
+
+type BackupInfo struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+	seq  int       // orders backups made within the same millisecond
+}
+
+// backupDir is the sidecar directory holding backups of path
+func backupDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".backups")
+}
+
+// saveBackup copies the current contents of path into the backup directory
+// and prunes old backups so at most keep remain
+func saveBackup(path string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dir := backupDir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating backup directory: %w", err)
+	}
+	if err := writeNewBackup(path, content); err != nil {
+		return err
+	}
+	backups, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(keep, len(backups)):] {
+		os.Remove(filepath.Join(dir, b.Name))
+	}
+	return nil
+}
+
+// writeNewBackup writes content under a new timestamped name. Saves within
+// the same millisecond get a sequence number instead of replacing each other.
+func writeNewBackup(path string, content []byte) (rtnErr error) {
+	stamp := filepath.Base(path) + "." + time.Now().Format(backupTimeFormat)
+	name := stamp + backupSuffix
+	for seq := 1; ; seq++ {
+		// backups hold the same secrets as the env file, so keep them private
+		fd, err := os.OpenFile(filepath.Join(backupDir(path), name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s%s%d%s", stamp, backupSeqSep, seq, backupSuffix)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("creating backup: %w", err)
+		}
+		defer func() {
+			if rtnErr != nil {
+				os.Remove(fd.Name())
+			}
+		}()
+		if _, err := fd.Write(content); err != nil {
+			fd.Close()
+			return fmt.Errorf("writing backup: %w", err)
+		}
+		if err := fd.Sync(); err != nil {
+			fd.Close()
+			return fmt.Errorf("syncing backup: %w", err)
+		}
+		return fd.Close()
+	}
+}
+
+// parseBackupName returns the time and sequence number of a backup name
+// (without the file name prefix and suffix)
+func parseBackupName(stamp string) (time.Time, int, bool) {
+	seq := 0
+	if idx := strings.LastIndex(stamp, backupSeqSep); idx >= 0 {
+		num, err := strconv.Atoi(stamp[idx+len(backupSeqSep):])
+		if err != nil {
+			return time.Time{}, 0, false
+		}
+		stamp, seq = stamp[:idx], num
+	}
+	ts, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return ts, seq, true
+}
+
+// listBackups returns the backups of path, newest first
+func listBackups(path string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(backupDir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "."
+	var rtn []BackupInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		ts, seq, ok := parseBackupName(strings.TrimSuffix(strings.TrimPrefix(name, prefix), backupSuffix))
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		rtn = append(rtn, BackupInfo{Name: name, Time: ts, Size: info.Size(), seq: seq})
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if !rtn[i].Time.Equal(rtn[j].Time) {
+			return rtn[i].Time.After(rtn[j].Time)
+		}
+		return rtn[i].seq > rtn[j].seq
+	})
+	return rtn, nil
+}
+
+// readBackupContent returns the raw bytes of a backup, for restoring it
+func readBackupContent(path string, name string) ([]byte, error) {
+	if name != filepath.Base(name) {
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+	return os.ReadFile(filepath.Join(backupDir(path), name))
+}
+
+func readBackup(path string, name string) (map[string]string, error) {
+	content, err := readBackupContent(path, name)
+	if err != nil {
+		return nil, err
+	}
+	// values that cannot be decrypted are shown as stored
+	env, _ := decryptEnv(parseEnv(string(content), detectFormat(path, string(content))))
+	return env, nil
+}
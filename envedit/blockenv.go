@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+// processEnv is the environment envedit was started with, which is the
+// environment of the shell in the block it was run from
+func processEnv() map[string]string {
+	rtn := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, val, ok := strings.Cut(kv, "=")
+		if ok && key != "" {
+			rtn[key] = val
+		}
+	}
+	return rtn
+}
+
+// pickKeys returns the entries of env whose keys are defined in keys
+func pickKeys(env map[string]string, keys map[string]string) map[string]string {
+	rtn := make(map[string]string)
+	for key := range keys {
+		if val, ok := env[key]; ok {
+			rtn[key] = val
+		}
+	}
+	return rtn
+}
+
+// diffProcessEnv compares the keys defined in fileEnv against env. Keys
+// only present in env (PATH, HOME, ...) are not reported.
+func diffProcessEnv(env map[string]string, fileEnv map[string]string) []EnvDiffEntry {
+	return diffEnv(pickKeys(env, fileEnv), fileEnv)
+}
+
+// secretKeys returns the keys whose effective value is encrypted in the
+// layer it comes from, or is interpolated from such a value. Their plaintext
+// must not end up in the block meta, which Wave stores on disk.
+func secretKeys(resolved map[string]*ResolvedKey, snaps []*EnvSnapshot, expansions map[string]*Expansion) map[string]bool {
+	rtn := make(map[string]bool)
+	for key, rk := range resolved {
+		if snaps[rk.Source].isEncrypted(key) {
+			rtn[key] = true
+		}
+	}
+	// Refs only lists direct references, follow them until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for key, exp := range expansions {
+			if rtn[key] {
+				continue
+			}
+			for _, ref := range exp.Refs {
+				if rtn[ref] {
+					rtn[key] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return rtn
+}
+
+// withoutKeys returns env without the entries in skip
+func withoutKeys(env map[string]string, skip map[string]bool) map[string]string {
+	rtn := make(map[string]string)
+	for key, val := range env {
+		if !skip[key] {
+			rtn[key] = val
+		}
+	}
+	return rtn
+}
+
+func blockORef() (waveobj.ORef, error) {
+	if AppClient.RpcContext == nil || AppClient.RpcContext.BlockId == "" {
+		return waveobj.ORef{}, fmt.Errorf("not running in a Wave block")
+	}
+	return waveobj.ORef{OType: "block", OID: AppClient.RpcContext.BlockId}, nil
+}
+
+// getBlockEnv returns the "cmd:env" meta of the block envedit was run from
+func getBlockEnv() (map[string]string, error) {
+	oref, err := blockORef()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := wshclient.GetMetaCommand(AppClient.RpcClient, wshrpc.CommandGetMetaData{ORef: oref}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting block meta: %w", err)
+	}
+	rtn := make(map[string]string)
+	if envMeta, ok := meta[waveobj.MetaKey_CmdEnv].(map[string]any); ok {
+		for key, val := range envMeta {
+			if s, ok := val.(string); ok {
+				rtn[key] = s
+			}
+		}
+	}
+	return rtn, nil
+}
+
+// applyBlockEnv merges vars into the block's "cmd:env" meta so commands
+// started in the block afterwards get them
+func applyBlockEnv(vars map[string]string) error {
+	oref, err := blockORef()
+	if err != nil {
+		return err
+	}
+	current, err := getBlockEnv()
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]any)
+	for key, val := range current {
+		merged[key] = val
+	}
+	for key, val := range vars {
+		merged[key] = val
+	}
+	err = wshclient.SetMetaCommand(AppClient.RpcClient, wshrpc.CommandSetMetaData{
+		ORef: oref,
+		Meta: map[string]any{waveobj.MetaKey_CmdEnv: merged},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("setting block meta: %w", err)
+	}
+	return nil
+}
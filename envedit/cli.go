@@ -0,0 +1,390 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Headless subcommands, for scripts and CI. They take the same flags as
+// the UI (-mode, -target, -schema, -key, ...) anywhere on the command line.
+// A <path> is an env file, a directory (see -mode) or several files joined
+// with the path list separator (":" on Unix), lowest precedence first, so
+// the same layer stack as in the UI can be used. Arguments after "--" are
+// never taken as a command, "env-editor -- get" opens a file named get.
+// Exit status is 0 on success, 1 on failure (validation errors, missing
+// key, differences for diff) and 2 on usage errors.
+
+const (
+	exitOk    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+var rawFlag = flag.Bool("raw", false, "get/list/diff: print values as written, without interpolation")
+
+type cliCommand struct {
+	Usage string
+	Run   func(args []string) int
+}
+
+var cliCommands = map[string]cliCommand{
+	"get":      {Usage: "get <path> KEY", Run: cliGet},
+	"set":      {Usage: "set <path> KEY=VALUE...", Run: cliSet},
+	"unset":    {Usage: "unset <path> KEY...", Run: cliUnset},
+	"list":     {Usage: "list <path>", Run: cliList},
+	"validate": {Usage: "validate <path>", Run: cliValidate},
+	"diff":     {Usage: "diff <path> [<other-path>]   (without other-path: against the current environment)", Run: cliDiff},
+}
+
+func printCliUsage() {
+	var names []string
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Commands (<path> is an env file, a directory (see -mode) or files joined with %q):\n", string(filepath.ListSeparator))
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  env-editor [flags] %s\n", cliCommands[name].Usage)
+	}
+}
+
+// parseArgs parses the flags anywhere in args (flag.Parse stops at the
+// first positional argument) and returns the positional arguments, and how
+// many of them came before "--" (-1 without "--")
+func parseArgs(args []string) ([]string, int) {
+	var rtn []string
+	for {
+		// the command line flag set exits on errors
+		flag.CommandLine.Parse(args)
+		rest := flag.CommandLine.Args()
+		if used := len(args) - len(rest); used > 0 && args[used-1] == "--" {
+			return append(rtn, rest...), len(rtn)
+		}
+		if len(rest) == 0 {
+			return rtn, -1
+		}
+		rtn = append(rtn, rest[0])
+		args = rest[1:]
+	}
+}
+
+// runCli runs the subcommand named by args[0]
+func runCli(args []string) int {
+	cmd := cliCommands[args[0]]
+	rtn := cmd.Run(args[1:])
+	if rtn == exitUsage {
+		fmt.Fprintf(os.Stderr, "Usage: env-editor [flags] %s\n", cmd.Usage)
+	}
+	return rtn
+}
+
+func cliError(format string, args ...any) int {
+	fmt.Fprintf(os.Stderr, "env-editor: "+format+"\n", args...)
+	return exitFail
+}
+
+// EnvStack is a loaded layer stack
+type EnvStack struct {
+	Paths  []string
+	Snaps  []*EnvSnapshot
+	Target int
+}
+
+// checkLayerDirs verifies the directory of every layer exists
+func checkLayerDirs(paths []string) error {
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("directory does not exist: %s", dir)
+		}
+	}
+	return nil
+}
+
+// pickTarget returns the index of the layer named target, the highest
+// precedence layer if target is empty
+func pickTarget(paths []string, target string) (int, error) {
+	if target == "" {
+		return len(paths) - 1, nil
+	}
+	rtn := -1
+	for idx, path := range paths {
+		if layerName(path) == target || path == target {
+			rtn = idx
+		}
+	}
+	if rtn < 0 {
+		return -1, fmt.Errorf("target layer %q is not in the stack", target)
+	}
+	return rtn, nil
+}
+
+// loadStack loads the layers of a <path> argument (see the top of the file)
+func loadStack(arg string) (*EnvStack, error) {
+	paths, err := resolveArgs(filepath.SplitList(arg), *modeFlag)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLayerDirs(paths); err != nil {
+		return nil, err
+	}
+	target, err := pickTarget(paths, *targetFlag)
+	if err != nil {
+		return nil, err
+	}
+	stack := &EnvStack{Paths: paths, Target: target}
+	for _, layerPath := range paths {
+		snap, err := readSnapshot(layerPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", layerPath, err)
+		}
+		var locked []string
+		for key := range snap.Locked {
+			locked = append(locked, key)
+		}
+		sort.Strings(locked)
+		for _, key := range locked {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s: %s, using it as stored\n", layerPath, key, snap.Locked[key])
+		}
+		stack.Snaps = append(stack.Snaps, snap)
+	}
+	return stack, nil
+}
+
+func (stack *EnvStack) envs() []map[string]string {
+	var rtn []map[string]string
+	for _, snap := range stack.Snaps {
+		rtn = append(rtn, snap.Env)
+	}
+	return rtn
+}
+
+// Effective returns the merged values of the stack, interpolated unless -raw
+func (stack *EnvStack) Effective() map[string]string {
+	resolved := resolveLayers(stack.Paths, stack.envs())
+	effective := effectiveEnv(resolved)
+	if *rawFlag {
+		return effective
+	}
+	return expandedValues(expandAll(effective, literalKeys(resolved, stack.Snaps)))
+}
+
+// write saves newMap to the target layer (with a backup, like the UI)
+func (stack *EnvStack) write(newMap map[string]string) error {
+	path := stack.Paths[stack.Target]
+	if err := saveBackup(path, *maxBackups); err != nil {
+		return fmt.Errorf("saving backup: %w", err)
+	}
+	_, err := writeSnapshot(path, stack.Snaps[stack.Target], newMap)
+	return err
+}
+
+func (stack *EnvStack) targetEnv() map[string]string {
+	rtn := make(map[string]string)
+	for key, val := range stack.Snaps[stack.Target].Env {
+		rtn[key] = val
+	}
+	return rtn
+}
+
+func cliGet(args []string) int {
+	if len(args) != 2 {
+		return exitUsage
+	}
+	stack, err := loadStack(args[0])
+	if err != nil {
+		return cliError("%v", err)
+	}
+	val, ok := stack.Effective()[args[1]]
+	if !ok {
+		return cliError("%s is not set", args[1])
+	}
+	if rk := resolveLayers(stack.Paths, stack.envs())[args[1]]; stack.Snaps[rk.Source].isLocked(args[1]) {
+		return cliError("%s cannot be decrypted", args[1])
+	}
+	fmt.Println(val)
+	return exitOk
+}
+
+func cliSet(args []string) int {
+	if len(args) < 2 {
+		return exitUsage
+	}
+	stack, err := loadStack(args[0])
+	if err != nil {
+		return cliError("%v", err)
+	}
+	newMap := stack.targetEnv()
+	changed := false
+	for _, arg := range args[1:] {
+		key, val, ok := strings.Cut(arg, "=")
+		if !ok {
+			return exitUsage
+		}
+		if !validKeyRe.MatchString(key) {
+			return cliError("%q is not a valid variable name", key)
+		}
+		if oldVal, ok := newMap[key]; !ok || oldVal != val {
+			changed = true
+		}
+		newMap[key] = val
+	}
+	// no write (and no backup) if every value is already set
+	if !changed {
+		return exitOk
+	}
+	if err := stack.write(newMap); err != nil {
+		return cliError("%v", err)
+	}
+	return exitOk
+}
+
+func cliUnset(args []string) int {
+	if len(args) < 2 {
+		return exitUsage
+	}
+	stack, err := loadStack(args[0])
+	if err != nil {
+		return cliError("%v", err)
+	}
+	newMap := stack.targetEnv()
+	changed := false
+	for _, key := range args[1:] {
+		if _, ok := newMap[key]; !ok {
+			fmt.Fprintf(os.Stderr, "env-editor: %s is not set in %s\n", key, layerName(stack.Paths[stack.Target]))
+			continue
+		}
+		delete(newMap, key)
+		changed = true
+	}
+	if !changed {
+		return exitOk
+	}
+	if err := stack.write(newMap); err != nil {
+		return cliError("%v", err)
+	}
+	return exitOk
+}
+
+func cliList(args []string) int {
+	if len(args) != 1 {
+		return exitUsage
+	}
+	stack, err := loadStack(args[0])
+	if err != nil {
+		return cliError("%v", err)
+	}
+	env := stack.Effective()
+	var keys []string
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Println(formatDotenvLine(key, env[key], false))
+	}
+	return exitOk
+}
+
+// cliValidate checks the schema and interpolation of the effective values.
+// Lint issues and undefined references are warnings, they do not fail.
+func cliValidate(args []string) int {
+	if len(args) != 1 {
+		return exitUsage
+	}
+	stack, err := loadStack(args[0])
+	if err != nil {
+		return cliError("%v", err)
+	}
+	schema, err := loadSchema(stack.Paths[0], *schemaPath)
+	if err != nil {
+		return cliError("loading schema: %v", err)
+	}
+	failed := false
+	for idx, snap := range stack.Snaps {
+		for _, issue := range lintEnv(snap.Content, snap.Format) {
+			loc := stack.Paths[idx]
+			if issue.Line > 0 {
+				loc = fmt.Sprintf("%s:%d", loc, issue.Line)
+			}
+			fmt.Printf("warning: %s: %s\n", loc, issue.Message)
+		}
+	}
+	resolved := resolveLayers(stack.Paths, stack.envs())
+	expansions := expandAll(effectiveEnv(resolved), literalKeys(resolved, stack.Snaps))
+	var keys []string
+	for key := range expansions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		exp := expansions[key]
+		for _, name := range exp.Undefined {
+			fmt.Printf("warning: %s: references undefined variable %s\n", key, name)
+		}
+		for _, msg := range exp.Errors {
+			fmt.Printf("error: %s: %s\n", key, msg)
+			failed = true
+		}
+	}
+	if schema != nil {
+		result := schema.Validate(expandedValues(expansions))
+		for _, key := range result.Missing {
+			fmt.Printf("error: %s: required but not set\n", key)
+		}
+		for _, key := range keys {
+			for _, msg := range result.errorsFor(key) {
+				fmt.Printf("error: %s: %s\n", key, msg)
+			}
+		}
+		for _, key := range result.Unknown {
+			fmt.Printf("warning: %s: not defined in the schema\n", key)
+		}
+		failed = failed || !result.IsValid()
+	}
+	if failed {
+		return exitFail
+	}
+	return exitOk
+}
+
+// cliDiff prints the differences from the first path to the second (or
+// to the current environment), exiting 1 if there are any like diff(1)
+func cliDiff(args []string) int {
+	if len(args) != 1 && len(args) != 2 {
+		return exitUsage
+	}
+	stack, err := loadStack(args[0])
+	if err != nil {
+		return cliError("%v", err)
+	}
+	var entries []EnvDiffEntry
+	if len(args) == 2 {
+		other, err := loadStack(args[1])
+		if err != nil {
+			return cliError("%v", err)
+		}
+		entries = diffEnv(stack.Effective(), other.Effective())
+	} else {
+		// only the keys of the file matter, report what the file would change
+		entries = diffProcessEnv(processEnv(), stack.Effective())
+	}
+	for _, entry := range entries {
+		switch entry.Kind {
+		case DiffAdded:
+			fmt.Printf("+ %s\n", formatDotenvLine(entry.Key, entry.New, false))
+		case DiffRemoved:
+			fmt.Printf("- %s\n", formatDotenvLine(entry.Key, entry.Old, false))
+		default:
+			fmt.Printf("- %s\n+ %s\n", formatDotenvLine(entry.Key, entry.Old, false), formatDotenvLine(entry.Key, entry.New, false))
+		}
+	}
+	if len(entries) > 0 {
+		return exitFail
+	}
+	return exitOk
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Encrypted values are stored in place of the plain value, one envelope per
+// value, so keys stay readable and diffs stay per key:
+//
+//	DB_PASSWORD=ENC[AES256_GCM,data:<base64>,iv:<base64>,tag:<base64>]
+//
+// data is the AES-256-GCM ciphertext of the value, iv the 12 byte nonce and
+// tag the 16 byte authentication tag (all standard base64). The key name is
+// used as additional authenticated data, so an envelope cannot be moved to
+// another key. Keys and comments are never encrypted.
+//
+// Values that cannot be decrypted (no key file, wrong key, tampered
+// envelope) are loaded as they are stored and shown read-only, saving the
+// file writes their envelopes back unchanged.
+//
+// The key file holds the 32 byte key as base64 (lines starting with "#" are
+// ignored), create one with:
+//
+//	head -c 32 /dev/urandom | base64 > ~/.config/envedit/key
+
+const (
+	encPrefix = "ENC[AES256_GCM,"
+	encSuffix = "]"
+	keySize   = 32
+	nonceSize = 12
+	tagSize   = 16
+)
+
+// envelopeRe is the full envelope grammar, anything else that merely starts
+// with "ENC[" is a plain value
+var envelopeRe = regexp.MustCompile(`^ENC\[AES256_GCM,data:([A-Za-z0-9+/]*={0,2}),iv:([A-Za-z0-9+/]+={0,2}),tag:([A-Za-z0-9+/]+={0,2})\]$`)
+
+var keyState struct {
+	lock sync.Mutex
+	key  []byte
+}
+
+// keyFilePath returns the key file from -key, $ENVEDIT_KEY_FILE or the
+// default location
+func keyFilePath() string {
+	if *keyFile != "" {
+		return *keyFile
+	}
+	if path := os.Getenv("ENVEDIT_KEY_FILE"); path != "" {
+		return path
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "envedit", "key")
+}
+
+// loadKey reads the key file on first use
+func loadKey() ([]byte, error) {
+	keyState.lock.Lock()
+	defer keyState.lock.Unlock()
+	if keyState.key != nil {
+		return keyState.key, nil
+	}
+	path := keyFilePath()
+	if path == "" {
+		return nil, fmt.Errorf("no key file (use -key or $ENVEDIT_KEY_FILE)")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	var encoded strings.Builder
+	for _, line := range splitLines(string(content)) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			encoded.WriteString(line)
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, fmt.Errorf("key file %s is not valid base64: %w", path, err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key file %s holds %d bytes, expected %d", path, len(key), keySize)
+	}
+	keyState.key = key
+	return key, nil
+}
+
+func makeGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isEncryptedValue(val string) bool {
+	return envelopeRe.MatchString(val)
+}
+
+// encryptValue seals val into an envelope bound to name
+func encryptValue(key []byte, name string, val string) (string, error) {
+	gcm, err := makeGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, nonce, []byte(val), []byte(name))
+	data, tag := sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:]
+	enc := base64.StdEncoding
+	return fmt.Sprintf("%sdata:%s,iv:%s,tag:%s%s", encPrefix, enc.EncodeToString(data), enc.EncodeToString(nonce), enc.EncodeToString(tag), encSuffix), nil
+}
+
+// decryptValue opens an envelope created by encryptValue
+func decryptValue(key []byte, name string, val string) (string, error) {
+	match := envelopeRe.FindStringSubmatch(val)
+	if match == nil {
+		return "", fmt.Errorf("malformed envelope")
+	}
+	var fields [3][]byte
+	for idx, fieldVal := range match[1:] {
+		decoded, err := base64.StdEncoding.DecodeString(fieldVal)
+		if err != nil {
+			return "", fmt.Errorf("malformed envelope: %w", err)
+		}
+		fields[idx] = decoded
+	}
+	data, nonce, tag := fields[0], fields[1], fields[2]
+	if len(nonce) != nonceSize || len(tag) != tagSize {
+		return "", fmt.Errorf("malformed envelope")
+	}
+	gcm, err := makeGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed := append(append([]byte{}, data...), tag...)
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt (wrong key or modified value)")
+	}
+	return string(plain), nil
+}
+
+// decryptEnv returns stored with all envelopes opened. The key is only
+// needed (and loaded) if the file has encrypted values. Envelopes that
+// cannot be opened keep their stored form and are returned in locked with
+// the reason.
+func decryptEnv(stored map[string]string) (env map[string]string, locked map[string]string) {
+	env = make(map[string]string)
+	locked = make(map[string]string)
+	for name, val := range stored {
+		env[name] = val
+		if !isEncryptedValue(val) {
+			continue
+		}
+		key, err := loadKey()
+		if err != nil {
+			locked[name] = err.Error()
+			continue
+		}
+		plain, err := decryptValue(key, name, val)
+		if err != nil {
+			locked[name] = err.Error()
+			continue
+		}
+		env[name] = plain
+	}
+	return env, locked
+}
+
+// hasEncrypted reports whether any value of the snapshot is encrypted
+func (s *EnvSnapshot) hasEncrypted() bool {
+	for _, val := range s.Stored {
+		if isEncryptedValue(val) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocked reports whether key is encrypted and could not be decrypted
+func (s *EnvSnapshot) isLocked(key string) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.Locked[key]
+	return ok
+}
+
+// isEncrypted reports whether key is stored encrypted in the snapshot
+func (s *EnvSnapshot) isEncrypted(key string) bool {
+	return s != nil && isEncryptedValue(s.Stored[key])
+}
+
+// encryptChanged returns the values to store for envMap. Unchanged values
+// keep their stored form (including the existing envelope), changed and new
+// values are encrypted if the file is encrypted or -encrypt is set. Values
+// that could not be decrypted cannot be changed, only deleted, and nothing
+// is encrypted into a file that has such values.
+func encryptChanged(tmpl *EnvSnapshot, envMap map[string]string) (map[string]string, error) {
+	encrypt := *encryptFlag || tmpl.hasEncrypted()
+	rtn := make(map[string]string)
+	for name, val := range envMap {
+		stored, ok := tmpl.Stored[name]
+		if ok && tmpl.Env[name] == val {
+			rtn[name] = stored
+			continue
+		}
+		if ok && tmpl.isLocked(name) {
+			return nil, fmt.Errorf("%s: %s, it is read-only", name, tmpl.Locked[name])
+		}
+		if !encrypt {
+			rtn[name] = val
+			continue
+		}
+		if len(tmpl.Locked) > 0 {
+			// the key differs from the one the file was encrypted with
+			return nil, fmt.Errorf("cannot encrypt %s, the file has values that cannot be decrypted", name)
+		}
+		key, err := loadKey()
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := encryptValue(key, name, val)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting %s: %w", name, err)
+		}
+		rtn[name] = sealed
+	}
+	return rtn, nil
+}
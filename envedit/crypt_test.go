@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	testKey  = bytes.Repeat([]byte{1}, keySize)
+	otherKey = bytes.Repeat([]byte{2}, keySize)
+)
+
+// useKey makes loadKey return key, or fail like a missing key file if key is nil
+func useKey(t *testing.T, key []byte) {
+	keyState.key = key
+	prevFile := *keyFile
+	*keyFile = filepath.Join(t.TempDir(), "missing-key")
+	t.Cleanup(func() {
+		keyState.key = nil
+		*keyFile = prevFile
+	})
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for _, val := range []string{"", "secret", "multi\nline ${NOT_EXPANDED} $$", strings.Repeat("x", 1000)} {
+		sealed, err := encryptValue(testKey, "DB_PASSWORD", val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncryptedValue(sealed) {
+			t.Fatalf("%q is not recognized as an envelope", sealed)
+		}
+		plain, err := decryptValue(testKey, "DB_PASSWORD", sealed)
+		if err != nil {
+			t.Fatalf("%q: %v", val, err)
+		}
+		if plain != val {
+			t.Errorf("got %q, want %q", plain, val)
+		}
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	sealed, err := encryptValue(testKey, "TOKEN", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptValue(otherKey, "TOKEN", sealed); err == nil {
+		t.Error("decrypted with the wrong key")
+	}
+}
+
+func TestDecryptMovedEnvelope(t *testing.T) {
+	sealed, err := encryptValue(testKey, "TOKEN", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key name is authenticated, the envelope only opens under TOKEN
+	if _, err := decryptValue(testKey, "OTHER_TOKEN", sealed); err == nil {
+		t.Error("envelope moved to another key was decrypted")
+	}
+}
+
+func TestIsEncryptedValue(t *testing.T) {
+	sealed, err := encryptValue(testKey, "A", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		val  string
+		want bool
+	}{
+		{sealed, true},
+		{"ENC[AES256_GCM,data:,iv:AAAAAAAAAAAAAAAA,tag:AAAAAAAAAAAAAAAAAAAAAA==]", true},
+		{"ENC[AES256_GCM,]", false},
+		{"ENC[AES256_GCM,data:abc]", false},
+		{"ENC[AES256_GCM,data:a b,iv:AAAA,tag:AAAA]", false},
+		{"ENC[AES256_GCM,data:AAAA,iv:AAAA,tag:AAAA] trailing", false},
+		{"ENC[something else]", false},
+		{"plain", false},
+	}
+	for _, tt := range tests {
+		if got := isEncryptedValue(tt.val); got != tt.want {
+			t.Errorf("isEncryptedValue(%q) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestDecryptEnvLocked(t *testing.T) {
+	good, err := encryptValue(testKey, "GOOD", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := encryptValue(otherKey, "BAD", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := map[string]string{"GOOD": good, "BAD": bad, "PLAIN": "1", "FAKE": "ENC[AES256_GCM,]"}
+
+	useKey(t, testKey)
+	env, locked := decryptEnv(stored)
+	want := map[string]string{"GOOD": "secret", "BAD": bad, "PLAIN": "1", "FAKE": "ENC[AES256_GCM,]"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("env: got %v, want %v", env, want)
+	}
+	if _, ok := locked["BAD"]; !ok || len(locked) != 1 {
+		t.Errorf("locked: got %v, want only BAD", locked)
+	}
+
+	// without a key file all envelopes are locked, the rest still loads
+	useKey(t, nil)
+	env, locked = decryptEnv(stored)
+	if env["PLAIN"] != "1" || env["GOOD"] != good || len(locked) != 2 {
+		t.Errorf("no key: got env %v, locked %v", env, locked)
+	}
+}
+
+func TestEncryptChangedKeepsLocked(t *testing.T) {
+	bad, err := encryptValue(otherKey, "BAD", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useKey(t, testKey)
+	good, err := encryptValue(testKey, "GOOD", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := map[string]string{"BAD": bad, "GOOD": good, "A": "1"}
+	env, locked := decryptEnv(stored)
+	tmpl := &EnvSnapshot{Env: env, Stored: stored, Locked: locked}
+
+	newMap := map[string]string{"BAD": env["BAD"], "GOOD": "secret", "A": "1", "NEW": "2"}
+	if _, err := encryptChanged(tmpl, newMap); err == nil {
+		t.Error("encrypted a new value with a key that cannot open the file")
+	}
+	delete(newMap, "NEW")
+	rtn, err := encryptChanged(tmpl, newMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rtn, stored) {
+		t.Errorf("got %v, want the stored values %v", rtn, stored)
+	}
+
+	newMap["BAD"] = "overwritten"
+	if _, err := encryptChanged(tmpl, newMap); err == nil {
+		t.Error("changed a value that cannot be decrypted")
+	}
+	delete(newMap, "BAD")
+	if _, err := encryptChanged(tmpl, newMap); err != nil {
+		t.Errorf("deleting a value that cannot be decrypted: %v", err)
+	}
+}
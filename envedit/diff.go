@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+type EnvDiffEntry struct {
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// diffEnv lists the keys that differ between from and to, sorted by key
+func diffEnv(from, to map[string]string) []EnvDiffEntry {
+	var rtn []EnvDiffEntry
+	for k, oldVal := range from {
+		newVal, ok := to[k]
+		if !ok {
+			rtn = append(rtn, EnvDiffEntry{Key: k, Kind: DiffRemoved, Old: oldVal})
+		} else if newVal != oldVal {
+			rtn = append(rtn, EnvDiffEntry{Key: k, Kind: DiffChanged, Old: oldVal, New: newVal})
+		}
+	}
+	for k, newVal := range to {
+		if _, ok := from[k]; !ok {
+			rtn = append(rtn, EnvDiffEntry{Key: k, Kind: DiffAdded, New: newVal})
+		}
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Key < rtn[j].Key
+	})
+	return rtn
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dotenv format:
+// KEY=value, one per line, blank lines and "# comment" lines are ignored
+// an optional "export " prefix is allowed
+// 'single quoted' values are literal
+// "double quoted" values may span lines and support \n \r \t \" \\ escapes
+// unquoted values are trimmed and end at " #" (inline comment)
+
+var dotenvUnquotedRe = regexp.MustCompile(`^[^\s#"'\\]*$`)
+
+// EnvEntry is one KEY=VALUE assignment, StartLine/EndLine are 0-based and
+// inclusive (EndLine > StartLine for multi-line quoted values)
+type EnvEntry struct {
+	Key          string
+	Value        string
+	Export       bool
+	StartLine    int
+	EndLine      int
+	Quote        byte // quote character of a quoted value, 0 if unquoted
+	Unterminated bool // the closing quote is missing
+}
+
+func splitLines(content string) []string {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// parseQuoted parses a value starting with a quote character. It may consume
+// following lines for double quoted values, returning the index of the last
+// line used. ok is false if the closing quote is never found.
+func parseQuoted(rest string, lines []string, lineIdx int) (val string, endLine int, ok bool) {
+	quote := rest[0]
+	if quote == '\'' {
+		end := strings.IndexByte(rest[1:], '\'')
+		if end < 0 {
+			return rest[1:], lineIdx, false
+		}
+		return rest[1 : end+1], lineIdx, true
+	}
+	var sb strings.Builder
+	cur := rest[1:]
+	for {
+		for i := 0; i < len(cur); i++ {
+			ch := cur[i]
+			if ch == '"' {
+				return sb.String(), lineIdx, true
+			}
+			if ch == '\\' && i+1 < len(cur) {
+				i++
+				switch cur[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(cur[i])
+				}
+				continue
+			}
+			sb.WriteByte(ch)
+		}
+		if lineIdx+1 >= len(lines) {
+			return sb.String(), lineIdx, false
+		}
+		lineIdx++
+		sb.WriteByte('\n')
+		cur = strings.TrimSuffix(lines[lineIdx], "\r")
+	}
+}
+
+// parseDotenvEntries returns every assignment in file order (duplicates included)
+func parseDotenvEntries(content string) []EnvEntry {
+	var rtn []EnvEntry
+	lines := splitLines(content)
+	for idx := 0; idx < len(lines); idx++ {
+		line := strings.TrimSpace(lines[idx])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := EnvEntry{StartLine: idx, EndLine: idx}
+		if strings.HasPrefix(line, "export ") {
+			entry.Export = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		}
+		eqIdx := strings.IndexByte(line, '=')
+		if eqIdx <= 0 {
+			continue
+		}
+		entry.Key = strings.TrimSpace(line[:eqIdx])
+		rest := strings.TrimLeft(line[eqIdx+1:], " \t")
+		if len(rest) > 0 && (rest[0] == '"' || rest[0] == '\'') {
+			var ok bool
+			entry.Quote = rest[0]
+			entry.Value, entry.EndLine, ok = parseQuoted(rest, lines, idx)
+			entry.Unterminated = !ok
+			idx = entry.EndLine
+		} else {
+			if commentIdx := strings.Index(rest, " #"); commentIdx >= 0 {
+				rest = rest[:commentIdx]
+			}
+			entry.Value = strings.TrimSpace(rest)
+		}
+		rtn = append(rtn, entry)
+	}
+	return rtn
+}
+
+// parseDotenv returns the effective values (the last assignment of a key wins)
+func parseDotenv(content string) map[string]string {
+	rtn := make(map[string]string)
+	for _, entry := range parseDotenvEntries(content) {
+		rtn[entry.Key] = entry.Value
+	}
+	return rtn
+}
+
+// literalDotenvKeys returns the keys whose effective assignment is single
+// quoted, their values are used as is without interpolation
+func literalDotenvKeys(content string) map[string]bool {
+	rtn := make(map[string]bool)
+	for _, entry := range parseDotenvEntries(content) {
+		rtn[entry.Key] = entry.Quote == '\''
+	}
+	return rtn
+}
+
+// canSingleQuote reports whether val can be written as a 'single quoted'
+// value, which has no escapes
+func canSingleQuote(val string) bool {
+	return !strings.ContainsAny(val, "'\n\r")
+}
+
+func quoteDotenvValue(val string) string {
+	if dotenvUnquotedRe.MatchString(val) {
+		return val
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(val) + `"`
+}
+
+func formatDotenvLine(key string, val string, export bool) string {
+	prefix := ""
+	if export {
+		prefix = "export "
+	}
+	return prefix + key + "=" + quoteDotenvValue(val)
+}
+
+// formatDotenv rewrites orig so it holds envMap. Lines of unchanged keys,
+// comments and blank lines are kept verbatim, changed keys are rewritten in
+// place (single quoted values stay single quoted when possible), removed
+// keys are dropped and new keys are appended in sorted order.
+func formatDotenv(orig string, envMap map[string]string) string {
+	lines := splitLines(orig)
+	entries := parseDotenvEntries(orig)
+	lastIdx := make(map[string]int)
+	for i, entry := range entries {
+		lastIdx[entry.Key] = i
+	}
+
+	var out []string
+	lineIdx := 0
+	for i, entry := range entries {
+		out = append(out, lines[lineIdx:entry.StartLine]...)
+		lineIdx = entry.EndLine + 1
+		newVal, ok := envMap[entry.Key]
+		switch {
+		case !ok:
+			// removed, drop every assignment of the key
+		case lastIdx[entry.Key] != i || newVal == entry.Value:
+			out = append(out, lines[entry.StartLine:entry.EndLine+1]...)
+		case entry.Quote == '\'' && canSingleQuote(newVal):
+			// keep the value literal (not interpolated)
+			prefix := ""
+			if entry.Export {
+				prefix = "export "
+			}
+			out = append(out, prefix+entry.Key+"='"+newVal+"'")
+		default:
+			out = append(out, formatDotenvLine(entry.Key, newVal, entry.Export))
+		}
+	}
+	out = append(out, lines[lineIdx:]...)
+
+	var newKeys []string
+	for k := range envMap {
+		if _, ok := lastIdx[k]; !ok {
+			newKeys = append(newKeys, k)
+		}
+	}
+	sort.Strings(newKeys)
+	for _, k := range newKeys {
+		out = append(out, formatDotenvLine(k, envMap[k], false))
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
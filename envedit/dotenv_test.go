@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		content string
+		want    map[string]string
+	}{
+		{"A=1\nB=2\n", map[string]string{"A": "1", "B": "2"}},
+		{"# comment\n\n  A = 1  \n", map[string]string{"A": "1"}},
+		{"export A=1\n", map[string]string{"A": "1"}},
+		{"A=1 # inline\nB=x#y\n", map[string]string{"A": "1", "B": "x#y"}},
+		{"A='lit $X \\n'\n", map[string]string{"A": "lit $X \\n"}},
+		{"A=\"a\\nb\\t\\\"c\\\\\"\n", map[string]string{"A": "a\nb\t\"c\\"}},
+		{"A=\"line1\nline2\"\nB=2\n", map[string]string{"A": "line1\nline2", "B": "2"}},
+		{"A=\"x # not a comment\"\n", map[string]string{"A": "x # not a comment"}},
+		{"A=1\nA=2\n", map[string]string{"A": "2"}},
+		{"A=\nB\n=C\n", map[string]string{"A": ""}},
+		{"A=1\r\nB=2\r\n", map[string]string{"A": "1", "B": "2"}},
+	}
+	for _, tt := range tests {
+		if got := parseDotenv(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDotenv(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDotenv(t *testing.T) {
+	orig := "# database\nexport DB_HOST=localhost # dev\nDB_PASS='p@ss'\n\n# multi\nCERT=\"a\nb\"\nOLD=1\nDUP=1\nDUP=2\n"
+	tests := []struct {
+		name   string
+		envMap map[string]string
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			envMap: map[string]string{"DB_HOST": "localhost", "DB_PASS": "p@ss", "CERT": "a\nb", "OLD": "1", "DUP": "2"},
+			want:   orig,
+		},
+		{
+			name:   "changed in place",
+			envMap: map[string]string{"DB_HOST": "db.example", "DB_PASS": "n3w$", "CERT": "a\nb", "OLD": "1", "DUP": "3"},
+			want:   "# database\nexport DB_HOST=db.example\nDB_PASS='n3w$'\n\n# multi\nCERT=\"a\nb\"\nOLD=1\nDUP=1\nDUP=3\n",
+		},
+		{
+			name:   "single quotes dropped when not possible",
+			envMap: map[string]string{"DB_HOST": "localhost", "DB_PASS": "it's", "CERT": "a\nb", "OLD": "1", "DUP": "2"},
+			want:   "# database\nexport DB_HOST=localhost # dev\nDB_PASS=\"it's\"\n\n# multi\nCERT=\"a\nb\"\nOLD=1\nDUP=1\nDUP=2\n",
+		},
+		{
+			name:   "removed and added",
+			envMap: map[string]string{"DB_HOST": "localhost", "DB_PASS": "p@ss", "CERT": "c", "ZED": "z", "NEW": "has space"},
+			want:   "# database\nexport DB_HOST=localhost # dev\nDB_PASS='p@ss'\n\n# multi\nCERT=c\nNEW=\"has space\"\nZED=z\n",
+		},
+		{
+			name:   "everything removed",
+			envMap: map[string]string{},
+			want:   "# database\n\n# multi\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDotenv(orig, tt.envMap)
+			if got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+			if parsed := parseDotenv(got); !reflect.DeepEqual(parsed, tt.envMap) {
+				t.Errorf("reparsed %v, want %v", parsed, tt.envMap)
+			}
+		})
+	}
+}
+
+func TestFormatDotenvEmpty(t *testing.T) {
+	if got := formatDotenv("", map[string]string{}); got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
+	want := "A=1\nB=\"x y\"\n"
+	if got := formatDotenv("", map[string]string{"B": "x y", "A": "1"}); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
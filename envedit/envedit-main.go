@@ -6,12 +6,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/wavetermdev/waveterm/pkg/util/envutil"
 	"github.com/wavetermdev/waveterm/pkg/vdom"
 	"github.com/wavetermdev/waveterm/pkg/waveapp"
 )
@@ -19,11 +18,31 @@ import (
 //go:embed style.css
 var styleCSS []byte
 
-var envPath string
+// envLayers is the stack of files being edited, lowest precedence first
+var envLayers []string
+
+var initialTarget int
+
+var maxBackups = flag.Int("backups", 20, "number of backups to keep (0 disables backups)")
+
+var schemaPath = flag.String("schema", "", "schema file (JSON schema or .env.example style), .env.example next to the file is used by default")
+
+var envSchema *Schema
+
+var modeFlag = flag.String("mode", "", "when opening a directory, also layer .env.<mode> and .env.<mode>.local")
+
+var targetFlag = flag.String("target", "", "name of the layer to edit (defaults to the highest precedence layer)")
+
+var keyFile = flag.String("key", "", "key file for encrypted values (defaults to $ENVEDIT_KEY_FILE or ~/.config/envedit/key)")
+
+var encryptFlag = flag.Bool("encrypt", false, "encrypt new and changed values even if the file has no encrypted values yet")
+
+const watchInterval = 1 * time.Second
 
 var AppClient = waveapp.MakeClient(waveapp.AppOpts{
-	CloseOnCtrlC: true,
-	GlobalStyles: styleCSS,
+	CloseOnCtrlC:         true,
+	GlobalKeyboardEvents: true,
+	GlobalStyles:         styleCSS,
 })
 
 type EnvItemProps struct {
@@ -35,6 +54,20 @@ type EnvItemProps struct {
 	OnCancel  func()               `json:"onCancel"` // Add this
 	IsEditing bool                 `json:"isEditing"`
 	Highlight bool                 `json:"highlight"`
+	Errors    []string             `json:"errors"`
+	Unknown   bool                 `json:"unknown"`
+	EditValue string               `json:"editValue"` // value in the target layer (or Value if not defined there)
+	Source    string               `json:"source"`    // layer the value comes from (only set when layered)
+	Inherited bool                 `json:"inherited"` // not defined in the target layer
+	Shadowed  []LayerValue         `json:"shadowed"`
+	Expanded  string               `json:"expanded"`  // interpolated value, if it differs from Value
+	RefIssues []string             `json:"refIssues"` // undefined references and cycles
+	IsRef     bool                 `json:"isRef"`     // references the key being edited
+	Encrypted bool                 `json:"encrypted"` // stored encrypted in the file
+	Locked    string               `json:"locked"`    // why the encrypted value could not be decrypted
+
+	Expand       func(string, string) *Expansion `json:"expand"`
+	ReferencedBy []string                        `json:"referencedBy"`
 }
 
 var EnvItem = waveapp.DefineComponent[EnvItemProps](AppClient, "EnvItem",
@@ -42,10 +75,13 @@ var EnvItem = waveapp.DefineComponent[EnvItemProps](AppClient, "EnvItem",
 		if props.IsEditing {
 			return EditForm(EditFormProps{
 				Key:      props.Key,
-				Value:    props.Value,
+				Value:    props.EditValue,
 				IsNew:    false,
 				OnSave:   props.OnSave,   // Use the passed save handler
 				OnCancel: props.OnCancel, // Use the passed cancel handler
+
+				Expand:       props.Expand,
+				ReferencedBy: props.ReferencedBy,
 			})
 		}
 
@@ -53,34 +89,109 @@ var EnvItem = waveapp.DefineComponent[EnvItemProps](AppClient, "EnvItem",
 			"className": vdom.Classes(
 				"env-item",
 				vdom.If(props.Highlight, "highlight"),
+				vdom.If(len(props.Errors) > 0, "invalid"),
+				vdom.If(props.Inherited, "inherited"),
+				vdom.If(props.IsRef, "is-ref"),
 			),
 		},
 			vdom.H("div", map[string]any{
 				"className": "env-item-key",
-			}, props.Key),
+			},
+				props.Key,
+				vdom.If(props.Encrypted,
+					vdom.H("i", map[string]any{
+						"className": "fa fa-lock env-item-lock",
+						"title":     vdom.IfElse(props.Locked != "", "Encrypted in the file, cannot be decrypted (read-only)", "Encrypted in the file"),
+					}),
+				),
+				vdom.If(props.Unknown,
+					vdom.H("span", map[string]any{
+						"className": "env-item-tag",
+						"title":     "Not defined in the schema",
+					}, "unknown"),
+				),
+			),
 			vdom.H("div", map[string]any{
 				"className": "env-item-value",
-			}, props.Value),
+			},
+				props.Value,
+				vdom.If(props.Source != "",
+					vdom.H("span", map[string]any{
+						"className": "env-item-source",
+					}, props.Source),
+				),
+				vdom.If(props.Expanded != "",
+					vdom.H("div", map[string]any{
+						"className": "env-item-expanded",
+					}, "= ", props.Expanded),
+				),
+				vdom.ForEach(props.RefIssues, func(msg string) any {
+					return vdom.H("div", map[string]any{
+						"className": "env-item-warning",
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-triangle-exclamation",
+						}),
+						" ", msg,
+					)
+				}),
+				vdom.ForEach(props.Shadowed, func(lv LayerValue) any {
+					return vdom.H("div", map[string]any{
+						"className": "env-item-shadowed",
+					},
+						vdom.H("span", map[string]any{
+							"className": "env-item-shadowed-value",
+						}, lv.Value),
+						vdom.H("span", map[string]any{
+							"className": "env-item-source",
+						}, lv.Layer),
+					)
+				}),
+				vdom.If(props.Locked != "",
+					vdom.H("div", map[string]any{
+						"className": "env-item-issue",
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-circle-exclamation",
+						}),
+						" ", props.Locked, ", kept as stored",
+					),
+				),
+				vdom.ForEach(props.Errors, func(msg string) any {
+					return vdom.H("div", map[string]any{
+						"className": "env-item-issue",
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-circle-exclamation",
+						}),
+						" ", msg,
+					)
+				}),
+			),
 			vdom.H("div", map[string]any{
 				"className": "env-item-actions",
 			},
-				vdom.H("button", map[string]any{
-					"className": "env-item-edit",
-					"onClick":   props.OnEdit,
-					"title":     "Edit",
-				},
-					vdom.H("i", map[string]any{
-						"className": "fa fa-pencil",
-					}),
+				vdom.If(props.Locked == "",
+					vdom.H("button", map[string]any{
+						"className": "env-item-edit",
+						"onClick":   props.OnEdit,
+						"title":     vdom.IfElse(props.Inherited, "Override in this layer", "Edit"),
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-pencil",
+						}),
+					),
 				),
-				vdom.H("button", map[string]any{
-					"className": "env-item-delete",
-					"onClick":   props.OnDelete,
-					"title":     "Delete",
-				},
-					vdom.H("i", map[string]any{
-						"className": "fa fa-times",
-					}),
+				vdom.If(!props.Inherited,
+					vdom.H("button", map[string]any{
+						"className": "env-item-delete",
+						"onClick":   props.OnDelete,
+						"title":     "Delete",
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-times",
+						}),
+					),
 				),
 			),
 		)
@@ -88,11 +199,13 @@ var EnvItem = waveapp.DefineComponent[EnvItemProps](AppClient, "EnvItem",
 )
 
 type EditFormProps struct {
-	Key      string               `json:"key"`
-	Value    string               `json:"value"`
-	IsNew    bool                 `json:"isNew"`
-	OnSave   func(string, string) `json:"onSave"`
-	OnCancel func()               `json:"onCancel"`
+	Key          string                          `json:"key"`
+	Value        string                          `json:"value"`
+	IsNew        bool                            `json:"isNew"`
+	OnSave       func(string, string)            `json:"onSave"`
+	OnCancel     func()                          `json:"onCancel"`
+	Expand       func(string, string) *Expansion `json:"expand"`
+	ReferencedBy []string                        `json:"referencedBy"`
 }
 
 var EditForm = waveapp.DefineComponent[EditFormProps](AppClient, "EditForm",
@@ -133,6 +246,23 @@ var EditForm = waveapp.DefineComponent[EditFormProps](AppClient, "EditForm",
 			PreventDefault: true,
 		}
 
+		var preview any
+		if props.Expand != nil && strings.Contains(value, "$") {
+			exp := props.Expand(key, value)
+			preview = vdom.H("div", map[string]any{
+				"className": "env-edit-preview",
+			},
+				vdom.H("div", map[string]any{
+					"className": "env-item-expanded",
+				}, "= ", exp.Value),
+				vdom.ForEach(exp.Issues(), func(msg string) any {
+					return vdom.H("div", map[string]any{
+						"className": "env-item-warning",
+					}, msg)
+				}),
+			)
+		}
+
 		return vdom.H("div", map[string]any{
 			"className": "env-item env-item-editing",
 		},
@@ -164,6 +294,12 @@ var EditForm = waveapp.DefineComponent[EditFormProps](AppClient, "EditForm",
 					"rows":        3,
 				}),
 			),
+			preview,
+			vdom.If(len(props.ReferencedBy) > 0,
+				vdom.H("div", map[string]any{
+					"className": "env-edit-refs",
+				}, "Referenced by: ", strings.Join(props.ReferencedBy, ", ")),
+			),
 			vdom.If(error != "",
 				vdom.H("div", map[string]any{
 					"className": "env-edit-error",
@@ -192,9 +328,19 @@ var EditForm = waveapp.DefineComponent[EditFormProps](AppClient, "EditForm",
 
 // HeaderProps breaks out all the header functionality
 type HeaderProps struct {
-	Path      string `json:"path"`
-	OnAddNew  func() `json:"onAddNew"`
-	IsEditing bool   `json:"isEditing"`
+	Path        string `json:"path"`
+	OnAddNew    func() `json:"onAddNew"`
+	IsEditing   bool   `json:"isEditing"`
+	CanUndo     bool   `json:"canUndo"`
+	CanRedo     bool   `json:"canRedo"`
+	OnUndo      func() `json:"onUndo"`
+	OnRedo      func() `json:"onRedo"`
+	OnBackups   func() `json:"onBackups"`
+	ShowBackups bool   `json:"showBackups"`
+	OnImport    func() `json:"onImport"`
+	ShowImport  bool   `json:"showImport"`
+	OnShellEnv  func() `json:"onShellEnv"`
+	ShowShell   bool   `json:"showShell"`
 }
 
 var Header = waveapp.DefineComponent[HeaderProps](AppClient, "Header",
@@ -206,6 +352,62 @@ var Header = waveapp.DefineComponent[HeaderProps](AppClient, "Header",
 			vdom.H("div", map[string]any{
 				"className": "env-path",
 			}, "Path: ", props.Path),
+			vdom.H("button", map[string]any{
+				"className": "env-tool",
+				"onClick":   props.OnUndo,
+				"disabled":  !props.CanUndo,
+				"title":     "Undo (Ctrl+Z)",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-rotate-left",
+				}),
+			),
+			vdom.H("button", map[string]any{
+				"className": "env-tool",
+				"onClick":   props.OnRedo,
+				"disabled":  !props.CanRedo,
+				"title":     "Redo (Ctrl+Shift+Z)",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-rotate-right",
+				}),
+			),
+			vdom.H("button", map[string]any{
+				"className": vdom.Classes(
+					"env-tool",
+					vdom.If(props.ShowBackups, "env-tool-active"),
+				),
+				"onClick": props.OnBackups,
+				"title":   "Restore a backup",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-clock-rotate-left",
+				}),
+			),
+			vdom.H("button", map[string]any{
+				"className": vdom.Classes(
+					"env-tool",
+					vdom.If(props.ShowImport, "env-tool-active"),
+				),
+				"onClick": props.OnImport,
+				"title":   "Import KEY=VALUE lines",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-file-import",
+				}),
+			),
+			vdom.H("button", map[string]any{
+				"className": vdom.Classes(
+					"env-tool",
+					vdom.If(props.ShowShell, "env-tool-active"),
+				),
+				"onClick": props.OnShellEnv,
+				"title":   "Compare with the shell and block environment",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-terminal",
+				}),
+			),
 			vdom.H("button", map[string]any{
 				"className": vdom.Classes(
 					"env-add",
@@ -226,160 +428,1484 @@ var Header = waveapp.DefineComponent[HeaderProps](AppClient, "Header",
 	},
 )
 
-var App = waveapp.DefineComponent(AppClient, "App",
-	func(ctx context.Context, _ any) any {
-		envMap, setEnvMap := vdom.UseState(ctx, map[string]string{})
-		editingKey, setEditingKey := vdom.UseState(ctx, "")
-		error, setError := vdom.UseState(ctx, "")
-		highlightKey, setHighlightKey := vdom.UseState(ctx, "")
-
-		// Clear highlight after delay
-		vdom.UseEffect(ctx, func() func() {
-			if highlightKey != "" {
-				timer := time.AfterFunc(1500*time.Millisecond, func() {
-					setHighlightKey("")
-					AppClient.SendAsyncInitiation()
-				})
-				return func() {
-					timer.Stop()
-				}
-			}
-			return nil
-		}, []any{highlightKey})
-
-		// Load environment file on mount
-		vdom.UseEffect(ctx, func() func() {
-			content, err := os.ReadFile(envPath)
-			if err != nil && !os.IsNotExist(err) {
-				setError(fmt.Sprintf("Error reading file: %v", err))
-				return nil
-			}
-			if len(content) > 0 {
-				setEnvMap(envutil.EnvToMap(string(content)))
-			}
-			return nil
-		}, []any{})
+// ChangeBannerProps is shown when the file was modified by another program
+type ChangeBannerProps struct {
+	OnReload  func() `json:"onReload"`
+	OnMerge   func() `json:"onMerge"`
+	OnDismiss func() `json:"onDismiss"`
+}
 
-		// Save environment to file
-		saveToFile := func(newMap map[string]string) {
-			content := envutil.MapToEnv(newMap)
-			err := os.WriteFile(envPath, []byte(content), 0644)
-			if err != nil {
-				setError(fmt.Sprintf("Error saving file: %v", err))
-				return
-			}
-			setEnvMap(newMap)
-		}
+var ChangeBanner = waveapp.DefineComponent[ChangeBannerProps](AppClient, "ChangeBanner",
+	func(ctx context.Context, props ChangeBannerProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "env-banner",
+		},
+			vdom.H("i", map[string]any{
+				"className": "fa fa-triangle-exclamation",
+			}),
+			vdom.H("span", map[string]any{
+				"className": "env-banner-text",
+			}, "The file has been changed on disk by another program."),
+			vdom.H("button", map[string]any{
+				"onClick": props.OnReload,
+				"title":   "Discard local state and load the file from disk",
+			}, "Reload"),
+			vdom.H("button", map[string]any{
+				"onClick": props.OnMerge,
+				"title":   "Merge the changes on disk with your edits",
+			}, "Merge"),
+			vdom.H("button", map[string]any{
+				"onClick": props.OnDismiss,
+				"title":   "Dismiss",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-times",
+				}),
+			),
+		)
+	},
+)
 
-		handleAdd := func() {
-			if editingKey != "" {
-				setEditingKey("")
-			} else {
-				setEditingKey("__new__")
-			}
-		}
+type MergeViewProps struct {
+	Conflicts []MergeConflict             `json:"conflicts"`
+	OnChoose  func(key string, ch string) `json:"onChoose"`
+	OnApply   func()                      `json:"onApply"`
+	OnCancel  func()                      `json:"onCancel"`
+}
 
-		handleEdit := func(key string) {
-			if editingKey == key {
-				setEditingKey("")
-			} else {
-				setEditingKey(key)
-			}
-		}
+func mergeValueText(v MergeValue) any {
+	if !v.Present {
+		return vdom.H("span", map[string]any{
+			"className": "env-merge-absent",
+		}, "(deleted)")
+	}
+	return v.Value
+}
 
-		handleDelete := func(key string) {
-			newMap := make(map[string]string)
-			for k, v := range envMap {
-				if k != key {
-					newMap[k] = v
-				}
+var MergeView = waveapp.DefineComponent[MergeViewProps](AppClient, "MergeView",
+	func(ctx context.Context, props MergeViewProps) any {
+		choiceCell := func(c MergeConflict, choice string) any {
+			val := c.Mine
+			if choice == MergeChoiceTheirs {
+				val = c.Theirs
 			}
-			saveToFile(newMap)
+			return vdom.H("div", map[string]any{
+				"className": vdom.Classes(
+					"env-merge-choice",
+					vdom.If(c.Choice == choice, "selected"),
+				),
+				"onClick": func() { props.OnChoose(c.Key, choice) },
+			}, mergeValueText(val))
 		}
 
-		handleSave := func(key, value string) {
-			newMap := make(map[string]string)
-			for k, v := range envMap {
-				newMap[k] = v
-			}
-			newMap[key] = value
-			saveToFile(newMap)
-			setEditingKey("")
-			setHighlightKey(key)
-		}
+		return vdom.H("div", map[string]any{
+			"className": "env-merge",
+		},
+			vdom.H("div", map[string]any{
+				"className": "env-merge-title",
+			}, fmt.Sprintf("%d conflicting key(s) changed both here and on disk", len(props.Conflicts))),
+			vdom.H("div", map[string]any{
+				"className": "env-merge-row env-merge-header",
+			},
+				vdom.H("div", nil, "Key"),
+				vdom.H("div", nil, "Original"),
+				vdom.H("div", nil, "Mine"),
+				vdom.H("div", nil, "On Disk"),
+			),
+			vdom.ForEach(props.Conflicts, func(c MergeConflict) any {
+				return vdom.H("div", map[string]any{
+					"key":       c.Key,
+					"className": "env-merge-row",
+				},
+					vdom.H("div", map[string]any{
+						"className": "env-item-key",
+					}, c.Key),
+					vdom.H("div", map[string]any{
+						"className": "env-merge-base",
+					}, mergeValueText(c.Base)),
+					choiceCell(c, MergeChoiceMine),
+					choiceCell(c, MergeChoiceTheirs),
+				)
+			}),
+			vdom.H("div", map[string]any{
+				"className": "env-edit-actions",
+			},
+				vdom.H("button", map[string]any{
+					"className": "env-edit-cancel",
+					"onClick":   props.OnCancel,
+				}, "Cancel"),
+				vdom.H("button", map[string]any{
+					"className": "env-edit-save",
+					"onClick":   props.OnApply,
+				},
+					vdom.H("i", map[string]any{
+						"className": "fa fa-check",
+					}),
+					" Save Merge",
+				),
+			),
+		)
+	},
+)
 
-		handleCancel := func() {
-			setEditingKey("")
-		}
+type EnvDiffProps struct {
+	Entries []EnvDiffEntry `json:"entries"`
+}
 
-		// Get sorted keys
-		var keys []string
-		for k := range envMap {
-			keys = append(keys, k)
+var EnvDiff = waveapp.DefineComponent[EnvDiffProps](AppClient, "EnvDiff",
+	func(ctx context.Context, props EnvDiffProps) any {
+		if len(props.Entries) == 0 {
+			return vdom.H("div", map[string]any{
+				"className": "env-diff-empty",
+			}, "No differences")
 		}
-		sort.Strings(keys)
-
 		return vdom.H("div", map[string]any{
-			"className": "env-editor",
+			"className": "env-diff",
 		},
-			Header(HeaderProps{
-				Path:      envPath,
-				OnAddNew:  handleAdd,
-				IsEditing: editingKey != "",
+			vdom.ForEach(props.Entries, func(entry EnvDiffEntry) any {
+				return vdom.H("div", map[string]any{
+					"key":       entry.Key,
+					"className": vdom.Classes("env-diff-row", "env-diff-"+entry.Kind),
+				},
+					vdom.H("div", map[string]any{
+						"className": "env-item-key",
+					}, entry.Key),
+					vdom.H("div", map[string]any{
+						"className": "env-diff-old",
+					}, vdom.If(entry.Kind != DiffAdded, entry.Old)),
+					vdom.H("div", map[string]any{
+						"className": "env-diff-new",
+					}, vdom.If(entry.Kind != DiffRemoved, entry.New)),
+				)
 			}),
+		)
+	},
+)
 
-			vdom.If(error != "",
-				vdom.H("div", map[string]any{
-					"className": "env-error",
-				}, error),
-			),
+type BackupViewProps struct {
+	Backups   []BackupInfo   `json:"backups"`
+	Selected  string         `json:"selected"`
+	Diff      []EnvDiffEntry `json:"diff"`
+	OnSelect  func(string)   `json:"onSelect"`
+	OnRestore func()         `json:"onRestore"`
+	OnClose   func()         `json:"onClose"`
+}
 
+var BackupView = waveapp.DefineComponent[BackupViewProps](AppClient, "BackupView",
+	func(ctx context.Context, props BackupViewProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "env-backups",
+		},
 			vdom.H("div", map[string]any{
-				"className": "env-list",
+				"className": "env-backups-list",
 			},
-				vdom.ForEach(keys, func(key string) any {
-					return EnvItem(EnvItemProps{
-						Key:       key,
-						Value:     envMap[key],
-						OnEdit:    func() { handleEdit(key) },
-						OnDelete:  func() { handleDelete(key) },
-						OnSave:    handleSave,   // Add this
-						OnCancel:  handleCancel, // Add this
-						IsEditing: key == editingKey,
-						Highlight: key == highlightKey,
-					})
+				vdom.If(len(props.Backups) == 0,
+					vdom.H("div", map[string]any{
+						"className": "env-diff-empty",
+					}, "No backups yet"),
+				),
+				vdom.ForEach(props.Backups, func(b BackupInfo) any {
+					return vdom.H("div", map[string]any{
+						"key": b.Name,
+						"className": vdom.Classes(
+							"env-backup",
+							vdom.If(b.Name == props.Selected, "selected"),
+						),
+						"onClick": func() { props.OnSelect(b.Name) },
+					},
+						b.Time.Format("2006-01-02 15:04:05"),
+						vdom.H("span", map[string]any{
+							"className": "env-backup-size",
+						}, fmt.Sprintf("%d bytes", b.Size)),
+					)
 				}),
-				// Add new item form at bottom
-				vdom.If(editingKey == "__new__",
-					EditForm(EditFormProps{
-						Key:      "",
-						Value:    "",
-						IsNew:    true,
-						OnSave:   handleSave,
-						OnCancel: handleCancel,
+			),
+			vdom.If(props.Selected != "",
+				vdom.H("div", map[string]any{
+					"className": "env-backups-diff",
+				},
+					vdom.H("div", map[string]any{
+						"className": "env-merge-title",
+					}, "Restoring this backup will make these changes:"),
+					EnvDiff(EnvDiffProps{Entries: props.Diff}),
+				),
+			),
+			vdom.H("div", map[string]any{
+				"className": "env-edit-actions",
+			},
+				vdom.H("button", map[string]any{
+					"className": "env-edit-cancel",
+					"onClick":   props.OnClose,
+				}, "Close"),
+				vdom.H("button", map[string]any{
+					"className": "env-edit-save",
+					"onClick":   props.OnRestore,
+					"disabled":  props.Selected == "",
+				},
+					vdom.H("i", map[string]any{
+						"className": "fa fa-clock-rotate-left",
 					}),
+					" Restore",
 				),
 			),
 		)
 	},
 )
 
-func main() {
-	AppClient.RegisterDefaultFlags()
-	flag.Parse()
-
-	if flag.NArg() != 1 {
-		fmt.Fprintf(os.Stderr, "Usage: env-editor [flags] <env-file-path>\n")
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
+type SchemaSummaryProps struct {
+	Sources      []string `json:"sources"`
+	Missing      []string `json:"missing"`
+	NumErrors    int      `json:"numErrors"`
+	NumUnknown   int      `json:"numUnknown"`
+	OnAddMissing func()   `json:"onAddMissing"`
+}
 
-	envPath = flag.Arg(0)
+var SchemaSummary = waveapp.DefineComponent[SchemaSummaryProps](AppClient, "SchemaSummary",
+	func(ctx context.Context, props SchemaSummaryProps) any {
+		ok := len(props.Missing) == 0 && props.NumErrors == 0
+		return vdom.H("div", map[string]any{
+			"className": vdom.Classes(
+				"env-schema",
+				vdom.IfElse(ok, "valid", "invalid"),
+			),
+		},
+			vdom.H("div", map[string]any{
+				"className": "env-schema-status",
+			},
+				vdom.H("i", map[string]any{
+					"className": vdom.Classes(
+						"fa",
+						vdom.IfElse(ok, "fa-circle-check", "fa-circle-exclamation"),
+					),
+				}),
+				fmt.Sprintf(" %d missing, %d invalid, %d unknown", len(props.Missing), props.NumErrors, props.NumUnknown),
+				vdom.H("span", map[string]any{
+					"className": "env-schema-sources",
+				}, "schema: ", strings.Join(props.Sources, ", ")),
+			),
+			vdom.If(len(props.Missing) > 0,
+				vdom.H("div", map[string]any{
+					"className": "env-schema-missing",
+				},
+					"Missing required keys: ",
+					vdom.H("span", map[string]any{
+						"className": "env-schema-keys",
+					}, strings.Join(props.Missing, ", ")),
+					vdom.H("button", map[string]any{
+						"className": "env-add",
+						"onClick":   props.OnAddMissing,
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-plus",
+						}),
+						" Add missing keys",
+					),
+				),
+			),
+		)
+	},
+)
+
+type LintPanelProps struct {
+	Issues   []LintIssue `json:"issues"`
+	Expanded bool        `json:"expanded"`
+	OnToggle func()      `json:"onToggle"`
+	OnFix    func(int)   `json:"onFix"`
+	OnFixAll func()      `json:"onFixAll"`
+}
+
+var LintPanel = waveapp.DefineComponent[LintPanelProps](AppClient, "LintPanel",
+	func(ctx context.Context, props LintPanelProps) any {
+		numFixable := 0
+		for _, issue := range props.Issues {
+			if issue.Fix != "" {
+				numFixable++
+			}
+		}
+		return vdom.H("div", map[string]any{
+			"className": "env-lint",
+		},
+			vdom.H("div", map[string]any{
+				"className": "env-lint-status",
+			},
+				vdom.H("i", map[string]any{
+					"className": "fa fa-triangle-exclamation",
+				}),
+				fmt.Sprintf(" %d lint issue(s) in the file", len(props.Issues)),
+				vdom.H("button", map[string]any{
+					"className": "env-edit-cancel",
+					"onClick":   props.OnToggle,
+				}, vdom.IfElse(props.Expanded, "Hide", "Show")),
+				vdom.If(numFixable > 0,
+					vdom.H("button", map[string]any{
+						"className": "env-add",
+						"onClick":   props.OnFixAll,
+					},
+						vdom.H("i", map[string]any{
+							"className": "fa fa-wand-magic-sparkles",
+						}),
+						" Fix all",
+					),
+				),
+			),
+			vdom.If(props.Expanded,
+				vdom.H("div", map[string]any{
+					"className": "env-lint-list",
+				},
+					vdom.ForEachIdx(props.Issues, func(issue LintIssue, idx int) any {
+						return vdom.H("div", map[string]any{
+							"key":       idx,
+							"className": "env-lint-issue",
+						},
+							vdom.H("span", map[string]any{
+								"className": "env-lint-line",
+							}, vdom.IfElse(issue.Line > 0, fmt.Sprintf("line %d", issue.Line), "file")),
+							vdom.H("span", map[string]any{
+								"className": "env-item-tag",
+							}, issue.Kind),
+							vdom.H("span", map[string]any{
+								"className": "env-lint-message",
+							}, issue.Message),
+							vdom.If(issue.Fix != "",
+								vdom.H("button", map[string]any{
+									"className": "env-edit-cancel",
+									"onClick":   func() { props.OnFix(idx) },
+									"title":     "Quick fix",
+								}, issue.Fix),
+							),
+						)
+					}),
+				),
+			),
+		)
+	},
+)
+
+type LayerTabsProps struct {
+	Layers   []LayerInfo `json:"layers"`
+	Target   int         `json:"target"`
+	OnSelect func(int)   `json:"onSelect"`
+}
+
+var LayerTabs = waveapp.DefineComponent[LayerTabsProps](AppClient, "LayerTabs",
+	func(ctx context.Context, props LayerTabsProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "env-layers",
+		},
+			vdom.H("span", map[string]any{
+				"className": "env-layers-label",
+			}, "Edit layer:"),
+			vdom.ForEachIdx(props.Layers, func(layer LayerInfo, idx int) any {
+				return vdom.H("button", map[string]any{
+					"key": layer.Path,
+					"className": vdom.Classes(
+						"env-layer",
+						vdom.If(idx == props.Target, "active"),
+						vdom.If(!layer.Exists, "missing"),
+					),
+					"onClick": func() { props.OnSelect(idx) },
+					"title":   layer.Path,
+				},
+					layer.Name,
+					vdom.H("span", map[string]any{
+						"className": "env-layer-count",
+					}, vdom.IfElse(layer.Exists, fmt.Sprintf("%d", layer.Count), "new")),
+				)
+			}),
+		)
+	},
+)
+
+type SearchBarProps struct {
+	Value    string       `json:"value"`
+	OnChange func(string) `json:"onChange"`
+	NumShown int          `json:"numShown"`
+	NumTotal int          `json:"numTotal"`
+}
+
+var SearchBar = waveapp.DefineComponent[SearchBarProps](AppClient, "SearchBar",
+	func(ctx context.Context, props SearchBarProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "env-search",
+		},
+			vdom.H("i", map[string]any{
+				"className": "fa fa-magnifying-glass",
+			}),
+			vdom.H("input", map[string]any{
+				"type":        "text",
+				"className":   "env-search-input",
+				"placeholder": "Search keys and values",
+				"value":       props.Value,
+				"onChange":    func(e vdom.VDomEvent) { props.OnChange(e.TargetValue) },
+			}),
+			vdom.If(props.Value != "",
+				vdom.H("span", map[string]any{
+					"className": "env-search-count",
+				}, fmt.Sprintf("%d of %d", props.NumShown, props.NumTotal)),
+			),
+			vdom.If(props.Value != "",
+				vdom.H("button", map[string]any{
+					"className": "env-search-clear",
+					"onClick":   func() { props.OnChange("") },
+					"title":     "Clear search",
+				},
+					vdom.H("i", map[string]any{
+						"className": "fa fa-times",
+					}),
+				),
+			),
+		)
+	},
+)
+
+type GroupHeaderProps struct {
+	Prefix    string `json:"prefix"`
+	Count     int    `json:"count"`
+	Collapsed bool   `json:"collapsed"`
+	OnToggle  func() `json:"onToggle"`
+}
+
+var GroupHeader = waveapp.DefineComponent[GroupHeaderProps](AppClient, "GroupHeader",
+	func(ctx context.Context, props GroupHeaderProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "env-group-header",
+			"onClick":   props.OnToggle,
+		},
+			vdom.H("i", map[string]any{
+				"className": vdom.Classes(
+					"fa",
+					vdom.IfElse(props.Collapsed, "fa-chevron-right", "fa-chevron-down"),
+				),
+			}),
+			vdom.H("span", map[string]any{
+				"className": "env-group-prefix",
+			}, props.Prefix+"*"),
+			vdom.H("span", map[string]any{
+				"className": "env-group-count",
+			}, props.Count),
+		)
+	},
+)
+
+type ImportViewProps struct {
+	Current map[string]string       `json:"current"`
+	OnApply func(map[string]string) `json:"onApply"`
+	OnClose func()                  `json:"onClose"`
+}
+
+var ImportView = waveapp.DefineComponent[ImportViewProps](AppClient, "ImportView",
+	func(ctx context.Context, props ImportViewProps) any {
+		text, setText := vdom.UseState(ctx, "")
+		skipped, setSkipped := vdom.UseState(ctx, map[string]bool{})
+
+		plan := planImport(text, props.Current)
+		selected := make(map[string]string)
+		for _, row := range plan.Rows {
+			if row.Kind != ImportSame && !skipped[row.Key] {
+				selected[row.Key] = row.New
+			}
+		}
+
+		toggleSkip := func(key string) {
+			newSkipped := make(map[string]bool)
+			for k, v := range skipped {
+				newSkipped[k] = v
+			}
+			newSkipped[key] = !skipped[key]
+			setSkipped(newSkipped)
+		}
+
+		return vdom.H("div", map[string]any{
+			"className": "env-import",
+		},
+			vdom.H("textarea", map[string]any{
+				"className":   "env-edit-value",
+				"value":       text,
+				"onChange":    func(e vdom.VDomEvent) { setText(e.TargetValue) },
+				"placeholder": "Paste KEY=VALUE lines (.env syntax)",
+				"rows":        8,
+			}),
+			vdom.If(len(plan.Invalid) > 0,
+				vdom.H("div", map[string]any{
+					"className": "env-item-warning",
+				}, fmt.Sprintf("%d line(s) ignored, not KEY=VALUE: %s", len(plan.Invalid), strings.Join(plan.Invalid, " | "))),
+			),
+			vdom.ForEach(plan.Rows, func(row ImportRow) any {
+				return vdom.H("div", map[string]any{
+					"key":       row.Key,
+					"className": vdom.Classes("env-import-row", "env-import-"+row.Kind),
+				},
+					vdom.H("input", map[string]any{
+						"type":     "checkbox",
+						"checked":  row.Kind != ImportSame && !skipped[row.Key],
+						"disabled": row.Kind == ImportSame,
+						"onChange": func() { toggleSkip(row.Key) },
+					}),
+					vdom.H("span", map[string]any{
+						"className": "env-import-kind",
+					}, row.Kind),
+					vdom.H("div", map[string]any{
+						"className": "env-item-key",
+					}, row.Key),
+					vdom.H("div", map[string]any{
+						"className": "env-diff-old",
+					}, vdom.If(row.Exists && row.Kind != ImportSame, row.Old)),
+					vdom.H("div", map[string]any{
+						"className": "env-diff-new",
+					},
+						row.New,
+						vdom.If(row.Kind == ImportConflict,
+							vdom.H("div", map[string]any{
+								"className": "env-item-warning",
+							}, fmt.Sprintf("pasted %d times with different values, the last one wins", len(row.Values))),
+						),
+					),
+				)
+			}),
+			vdom.H("div", map[string]any{
+				"className": "env-edit-actions",
+			},
+				vdom.H("button", map[string]any{
+					"className": "env-edit-cancel",
+					"onClick":   props.OnClose,
+				}, "Close"),
+				vdom.H("button", map[string]any{
+					"className": "env-edit-save",
+					"onClick":   func() { props.OnApply(selected) },
+					"disabled":  len(selected) == 0,
+				},
+					vdom.H("i", map[string]any{
+						"className": "fa fa-check",
+					}),
+					fmt.Sprintf(" Import %d", len(selected)),
+				),
+			),
+		)
+	},
+)
+
+type ShellEnvViewProps struct {
+	ProcessDiff []EnvDiffEntry `json:"processDiff"`
+	BlockDiff   []EnvDiffEntry `json:"blockDiff"`
+	BlockError  string         `json:"blockError"`
+	Secrets     []string       `json:"secrets"` // encrypted keys, never applied to the block
+	Status      string         `json:"status"`
+	OnApply     func()         `json:"onApply"`
+	OnRefresh   func()         `json:"onRefresh"`
+	OnClose     func()         `json:"onClose"`
+}
+
+var ShellEnvView = waveapp.DefineComponent[ShellEnvViewProps](AppClient, "ShellEnvView",
+	func(ctx context.Context, props ShellEnvViewProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "env-shell",
+		},
+			vdom.H("div", map[string]any{
+				"className": "env-merge-title",
+			}, "Shell environment vs file (values after interpolation)"),
+			EnvDiff(EnvDiffProps{Entries: props.ProcessDiff}),
+			vdom.H("div", map[string]any{
+				"className": "env-merge-title env-shell-block",
+			}, "Block environment (cmd:env) vs file"),
+			vdom.IfElse(props.BlockError != "",
+				vdom.H("div", map[string]any{
+					"className": "env-item-warning",
+				}, props.BlockError),
+				EnvDiff(EnvDiffProps{Entries: props.BlockDiff}),
+			),
+			vdom.If(len(props.Secrets) > 0,
+				vdom.H("div", map[string]any{
+					"className": "env-shell-status",
+				},
+					vdom.H("i", map[string]any{
+						"className": "fa fa-lock",
+					}),
+					" Encrypted values are not applied to the block: ", strings.Join(props.Secrets, ", "),
+				),
+			),
+			vdom.If(props.Status != "",
+				vdom.H("div", map[string]any{
+					"className": "env-shell-status",
+				}, props.Status),
+			),
+			vdom.H("div", map[string]any{
+				"className": "env-edit-actions",
+			},
+				vdom.H("button", map[string]any{
+					"className": "env-edit-cancel",
+					"onClick":   props.OnClose,
+				}, "Close"),
+				vdom.H("button", map[string]any{
+					"className": "env-edit-cancel",
+					"onClick":   props.OnRefresh,
+				}, "Refresh"),
+				vdom.H("button", map[string]any{
+					"className": "env-edit-save",
+					"onClick":   props.OnApply,
+					"disabled":  props.BlockError != "" || len(props.BlockDiff) == 0,
+					"title":     "Set these variables in the block's cmd:env, new commands in the block will get them",
+				},
+					vdom.H("i", map[string]any{
+						"className": "fa fa-terminal",
+					}),
+					" Apply to Block",
+				),
+			),
+		)
+	},
+)
+
+type EnvEditorProps struct {
+	Layers   []string  `json:"layers"`
+	Target   int       `json:"target"`
+	OnTarget func(int) `json:"onTarget"`
+}
+
+var App = waveapp.DefineComponent(AppClient, "App",
+	func(ctx context.Context, _ any) any {
+		target, setTarget := vdom.UseState(ctx, initialTarget)
+		// keyed by path so switching layers starts a fresh editor
+		return EnvEditor(EnvEditorProps{
+			Layers:   envLayers,
+			Target:   target,
+			OnTarget: setTarget,
+		}).WithKey(envLayers[target])
+	},
+)
+
+var EnvEditor = waveapp.DefineComponent[EnvEditorProps](AppClient, "EnvEditor",
+	func(ctx context.Context, props EnvEditorProps) any {
+		envPath := props.Layers[props.Target]
+		envMap, setEnvMap := vdom.UseState(ctx, map[string]string{})
+		editingKey, setEditingKey := vdom.UseState(ctx, "")
+		error, setError := vdom.UseState(ctx, "")
+		highlightKey, setHighlightKey := vdom.UseState(ctx, "")
+		diskChanged, setDiskChanged := vdom.UseState(ctx, false)
+		mergeState, setMergeState := vdom.UseState(ctx, (*MergeState)(nil))
+		fileState := vdom.UseRef(ctx, &FileState{})
+		history := vdom.UseRef(ctx, &EditHistory{})
+		keyActions := vdom.UseRef(ctx, struct {
+			undo func()
+			redo func()
+		}{})
+		showBackups, setShowBackups := vdom.UseState(ctx, false)
+		backups, setBackups := vdom.UseState(ctx, []BackupInfo{})
+		selectedBackup, setSelectedBackup := vdom.UseState(ctx, "")
+		backupMap, setBackupMap := vdom.UseState(ctx, map[string]string{})
+		// snapshots of the other layers. polledSnaps belongs to the poll
+		// goroutine, render only sees the copies handed over in layerSnaps.
+		layerSnaps, setLayerSnaps := vdom.UseState(ctx, make([]*EnvSnapshot, len(props.Layers)))
+		polledSnaps := vdom.UseRef(ctx, make([]*EnvSnapshot, len(props.Layers)))
+		search, setSearch := vdom.UseState(ctx, "")
+		collapsed, setCollapsed := vdom.UseState(ctx, map[string]bool{})
+		showImport, setShowImport := vdom.UseState(ctx, false)
+		showShell, setShowShell := vdom.UseState(ctx, false)
+		blockEnv, setBlockEnv := vdom.UseState(ctx, map[string]string{})
+		blockError, setBlockError := vdom.UseState(ctx, "")
+		shellStatus, setShellStatus := vdom.UseState(ctx, "")
+		showLint, setShowLint := vdom.UseState(ctx, true)
+
+		// Clear highlight after delay
+		vdom.UseEffect(ctx, func() func() {
+			if highlightKey != "" {
+				timer := time.AfterFunc(1500*time.Millisecond, func() {
+					setHighlightKey("")
+					AppClient.SendAsyncInitiation()
+				})
+				return func() {
+					timer.Stop()
+				}
+			}
+			return nil
+		}, []any{highlightKey})
+
+		// Load environment file on mount
+		vdom.UseEffect(ctx, func() func() {
+			snap, err := readSnapshot(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading file: %v", err))
+				return nil
+			}
+			fileState.Current.SetBase(snap)
+			setEnvMap(snap.Env)
+
+			// the other layers are read-only here
+			snaps := make([]*EnvSnapshot, len(props.Layers))
+			for idx, path := range props.Layers {
+				if idx == props.Target {
+					continue
+				}
+				snap, err := readSnapshot(path)
+				if err != nil {
+					setError(fmt.Sprintf("Error reading %s: %v", path, err))
+					continue
+				}
+				snaps[idx] = snap
+			}
+			polledSnaps.Current = snaps
+			setLayerSnaps(snaps)
+			return nil
+		}, []any{})
+
+		// Poll the file for changes made by other programs
+		vdom.UseEffect(ctx, func() func() {
+			done := make(chan bool)
+
+			// pollTarget checks the edited file, returning true if a new
+			// version showed up on disk
+			pollTarget := func() bool {
+				state := fileState.Current
+				base := state.GetBase()
+				if base == nil || base.unchanged(envPath) {
+					return false
+				}
+				if disk := state.GetDisk(); disk != nil && disk.unchanged(envPath) {
+					return false
+				}
+				snap, err := readSnapshot(envPath)
+				if err != nil {
+					return false
+				}
+				if snap.sameContent(base) {
+					// touched but not modified, treat it as our base from now on
+					state.SetBase(snap)
+					return false
+				}
+				state.SetDisk(snap)
+				setDiskChanged(true)
+				return true
+			}
+
+			// pollLayers re-reads the other layers when they change. It works on
+			// a copy, as render may still hold the previous slice.
+			pollLayers := func() bool {
+				changed := false
+				snaps := slices.Clone(polledSnaps.Current)
+				for idx, path := range props.Layers {
+					if snaps[idx] == nil || snaps[idx].unchanged(path) {
+						continue
+					}
+					snap, err := readSnapshot(path)
+					if err != nil {
+						continue
+					}
+					snaps[idx] = snap
+					changed = true
+				}
+				if changed {
+					polledSnaps.Current = snaps
+					setLayerSnaps(snaps)
+				}
+				return changed
+			}
+
+			go func() {
+				ticker := time.NewTicker(watchInterval)
+				defer ticker.Stop()
+
+				for {
+					select {
+					case <-done:
+						return
+					case <-ticker.C:
+						layersChanged := pollLayers()
+						if pollTarget() || layersChanged {
+							AppClient.SendAsyncInitiation()
+						}
+					}
+				}
+			}()
+
+			return func() {
+				close(done)
+			}
+		}, []any{})
+
+		// writeFile backs up the file, writes it with write and records the
+		// replaced version for undo
+		writeFile := func(write snapshotWriter) bool {
+			prev, err := readVersion(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading file: %v", err))
+				return false
+			}
+			if err := saveBackup(envPath, *maxBackups); err != nil {
+				setError(fmt.Sprintf("Error saving backup: %v", err))
+				return false
+			}
+			snap, err := write()
+			if err != nil {
+				setError(fmt.Sprintf("Error saving file: %v", err))
+				return false
+			}
+			history.Current.Record(prev)
+			fileState.Current.SetBase(snap)
+			setEnvMap(snap.Env)
+			setDiskChanged(false)
+			setError("")
+			return true
+		}
+
+		writeMap := func(newMap map[string]string, tmpl *EnvSnapshot) bool {
+			return writeFile(mapWriter(envPath, tmpl, newMap))
+		}
+
+		// restoreVersion puts back an earlier version byte for byte (undo,
+		// redo and backups). It refuses to run over changes made on disk
+		// since we last read the file, those would be lost without a merge.
+		restoreVersion := func(ver FileVersion) bool {
+			base := fileState.Current.GetBase()
+			if base == nil || !base.unchanged(envPath) {
+				setError("The file changed on disk, reload before restoring")
+				return false
+			}
+			return writeFile(versionWriter(envPath, ver, base.Mode))
+		}
+
+		// mergeWith merges mine (edits of base) with the current file on disk,
+		// writing the result directly when there is nothing for the user to
+		// decide. The base only moves once the merged result is written.
+		mergeWith := func(base *EnvSnapshot, mine map[string]string) bool {
+			disk, err := readSnapshot(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading file: %v", err))
+				return false
+			}
+			// without a base (the initial load failed) every key on disk
+			// counts as theirs, so nothing on disk is dropped
+			baseEnv := map[string]string{}
+			if base != nil {
+				baseEnv = base.Env
+			}
+			merged, conflicts := mergeEnv(baseEnv, mine, disk.Env)
+			if len(conflicts) > 0 {
+				setMergeState(&MergeState{
+					Merged:    merged,
+					Conflicts: conflicts,
+					Disk:      disk,
+				})
+				return false
+			}
+			return writeMap(merged, disk)
+		}
+
+		startMerge := func(mine map[string]string) bool {
+			return mergeWith(fileState.Current.GetBase(), mine)
+		}
+
+		// Save environment to file, merging if it changed since we loaded it
+		saveToFile := func(newMap map[string]string) bool {
+			base := fileState.Current.GetBase()
+			if base == nil || !base.unchanged(envPath) {
+				return startMerge(newMap)
+			}
+			return writeMap(newMap, base)
+		}
+
+		handleReload := func() {
+			snap, err := readSnapshot(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading file: %v", err))
+				return
+			}
+			fileState.Current.SetBase(snap)
+			setEnvMap(snap.Env)
+			setDiskChanged(false)
+			setMergeState(nil)
+			setEditingKey("")
+		}
+
+		handleMergeChoose := func(key string, choice string) {
+			if mergeState == nil {
+				return
+			}
+			newState := *mergeState
+			newState.Conflicts = make([]MergeConflict, len(mergeState.Conflicts))
+			copy(newState.Conflicts, mergeState.Conflicts)
+			for i := range newState.Conflicts {
+				if newState.Conflicts[i].Key == key {
+					newState.Conflicts[i].Choice = choice
+				}
+			}
+			setMergeState(&newState)
+		}
+
+		handleMergeApply := func() {
+			if mergeState == nil {
+				return
+			}
+			disk := mergeState.Disk
+			if !disk.unchanged(envPath) {
+				// the file moved again while resolving, the resolved values are
+				// edits of disk, merge them against the new version
+				setMergeState(nil)
+				mergeWith(disk, mergeState.resolve())
+				return
+			}
+			// writeMap sets the base once the write succeeded
+			if writeMap(mergeState.resolve(), disk) {
+				setMergeState(nil)
+			}
+		}
+
+		handleUndo := func() {
+			cur, err := readVersion(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading file: %v", err))
+				return
+			}
+			history.Current.StepUndo(cur, restoreVersion)
+		}
+
+		handleRedo := func() {
+			cur, err := readVersion(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading file: %v", err))
+				return
+			}
+			history.Current.StepRedo(cur, restoreVersion)
+		}
+
+		// The global key handler is installed once and calls through this ref
+		// to reach the latest render. While the edit form is open the actions
+		// are cleared so Ctrl+Z stays text undo inside the inputs.
+		keyActions.Current.undo = nil
+		keyActions.Current.redo = nil
+		if editingKey == "" {
+			keyActions.Current.undo = handleUndo
+			keyActions.Current.redo = handleRedo
+		}
+
+		vdom.UseEffect(ctx, func() func() {
+			AppClient.SetGlobalEventHandler(func(client *waveapp.Client, event vdom.VDomEvent) {
+				if event.EventType != "onKeyDown" || event.KeyData == nil {
+					return
+				}
+				keyData := event.KeyData
+				if !(keyData.Control || keyData.Meta) || strings.ToLower(keyData.Key) != "z" {
+					return
+				}
+				action := keyActions.Current.undo
+				if keyData.Shift {
+					action = keyActions.Current.redo
+				}
+				if action == nil {
+					return
+				}
+				action()
+				client.SendAsyncInitiation()
+			})
+			return nil
+		}, []any{})
+
+		refreshBackups := func() {
+			list, err := listBackups(envPath)
+			if err != nil {
+				setError(fmt.Sprintf("Error listing backups: %v", err))
+				return
+			}
+			setBackups(list)
+		}
+
+		handleToggleBackups := func() {
+			if !showBackups {
+				refreshBackups()
+			}
+			setShowBackups(!showBackups)
+			setSelectedBackup("")
+		}
+
+		handleSelectBackup := func(name string) {
+			m, err := readBackup(envPath, name)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading backup: %v", err))
+				return
+			}
+			setSelectedBackup(name)
+			setBackupMap(m)
+		}
+
+		handleRestoreBackup := func() {
+			if selectedBackup == "" {
+				return
+			}
+			content, err := readBackupContent(envPath, selectedBackup)
+			if err != nil {
+				setError(fmt.Sprintf("Error reading backup: %v", err))
+				return
+			}
+			if restoreVersion(FileVersion{Content: content, Exists: true}) {
+				setShowBackups(false)
+				setSelectedBackup("")
+			}
+		}
+
+		// resolve the target layer's (possibly unsaved) map with the other layers
+		envs := make([]map[string]string, len(props.Layers))
+		for idx, snap := range layerSnaps {
+			if snap != nil {
+				envs[idx] = snap.Env
+			}
+		}
+		envs[props.Target] = envMap
+		resolved := resolveLayers(props.Layers, envs)
+		isLayered := len(props.Layers) > 1
+
+		snaps := make([]*EnvSnapshot, len(props.Layers))
+		copy(snaps, layerSnaps)
+		snaps[props.Target] = fileState.Current.GetBase()
+		literal := literalKeys(resolved, snaps)
+
+		effective := effectiveEnv(resolved)
+		expansions := expandAll(effective, literal)
+		refsTo := referencedBy(expansions)
+
+		expand := func(key string, value string) *Expansion {
+			env := make(map[string]string)
+			for k, v := range effective {
+				env[k] = v
+			}
+			env[key] = value
+			// the edit is saved to the target layer, single quoted if it was
+			editLiteral := make(map[string]bool)
+			for k, v := range literal {
+				editLiteral[k] = v
+			}
+			target := snaps[props.Target]
+			editLiteral[key] = target != nil && target.Literal[key] && canSingleQuote(value)
+			return expandValue(key, value, env, editLiteral)
+		}
+
+		// validate what the program will see, after interpolation
+		var validation *ValidationResult
+		if envSchema != nil {
+			validation = envSchema.Validate(expandedValues(expansions))
+		}
+
+		handleAddMissing := func() {
+			if validation == nil || len(validation.Missing) == 0 {
+				return
+			}
+			newMap := make(map[string]string)
+			for k, v := range envMap {
+				newMap[k] = v
+			}
+			for k, v := range envSchema.MissingDefaults(validation.Missing) {
+				newMap[k] = v
+			}
+			saveToFile(newMap)
+		}
+
+		var mergeView any
+		if mergeState != nil {
+			mergeView = MergeView(MergeViewProps{
+				Conflicts: mergeState.Conflicts,
+				OnChoose:  handleMergeChoose,
+				OnApply:   handleMergeApply,
+				OnCancel:  func() { setMergeState(nil) },
+			})
+		}
+
+		var schemaSummary any
+		if validation != nil {
+			schemaSummary = SchemaSummary(SchemaSummaryProps{
+				Sources:      envSchema.Sources,
+				Missing:      validation.Missing,
+				NumErrors:    len(validation.Errors),
+				NumUnknown:   len(validation.Unknown),
+				OnAddMissing: handleAddMissing,
+			})
+		}
+
+		var lintIssues []LintIssue
+		if base := fileState.Current.GetBase(); base != nil {
+			lintIssues = lintEnv(base.Content, base.Format)
+		}
+
+		// applyLint writes the fixed content as is (keys are renamed on their
+		// own line), with a backup and an undo step like any other save
+		applyLint := func(fix func(content string, format string) (string, map[string]string)) {
+			base := fileState.Current.GetBase()
+			if base == nil || !base.unchanged(envPath) {
+				setError("The file changed on disk, reload before applying fixes")
+				return
+			}
+			content, renames := fix(base.Content, base.Format)
+			content, err := resealRenamed(content, base.Format, renames)
+			if err != nil {
+				setError(fmt.Sprintf("Error applying fix: %v", err))
+				return
+			}
+			writeFile(contentWriter(envPath, []byte(content), base.Mode))
+		}
+
+		handleLintFix := func(idx int) {
+			if idx < 0 || idx >= len(lintIssues) {
+				return
+			}
+			issue := []LintIssue{lintIssues[idx]}
+			applyLint(func(content string, format string) (string, map[string]string) {
+				return applyLintFixes(content, format, issue), lintRenames(issue)
+			})
+		}
+
+		handleImport := func(values map[string]string) {
+			newMap := make(map[string]string)
+			for k, v := range envMap {
+				newMap[k] = v
+			}
+			for k, v := range values {
+				newMap[k] = v
+			}
+			if saveToFile(newMap) {
+				setShowImport(false)
+			}
+		}
+
+		toggleGroup := func(prefix string) {
+			newCollapsed := make(map[string]bool)
+			for k, v := range collapsed {
+				newCollapsed[k] = v
+			}
+			newCollapsed[prefix] = !collapsed[prefix]
+			setCollapsed(newCollapsed)
+		}
+
+		expandedEnv := expandedValues(expansions)
+
+		// block meta is stored on disk by Wave, keep decrypted values out of it
+		secrets := secretKeys(resolved, snaps, expansions)
+		blockVars := withoutKeys(expandedEnv, secrets)
+		var secretNames []string
+		for key := range secrets {
+			secretNames = append(secretNames, key)
+		}
+		sort.Strings(secretNames)
+
+		refreshBlockEnv := func() {
+			m, err := getBlockEnv()
+			if err != nil {
+				setBlockError(err.Error())
+				return
+			}
+			setBlockError("")
+			setBlockEnv(m)
+		}
+
+		handleToggleShell := func() {
+			if !showShell {
+				refreshBlockEnv()
+				setShellStatus("")
+			}
+			setShowShell(!showShell)
+		}
+
+		handleApplyBlockEnv := func() {
+			if err := applyBlockEnv(blockVars); err != nil {
+				setShellStatus(fmt.Sprintf("Error: %v", err))
+				return
+			}
+			refreshBlockEnv()
+			setShellStatus(fmt.Sprintf("Set %d variable(s) in the block environment, new commands in the block will use them.", len(blockVars)))
+		}
+
+		handleAdd := func() {
+			if editingKey != "" {
+				setEditingKey("")
+			} else {
+				setEditingKey("__new__")
+			}
+		}
+
+		handleEdit := func(key string) {
+			if editingKey == key {
+				setEditingKey("")
+			} else {
+				setEditingKey(key)
+			}
+		}
+
+		handleDelete := func(key string) {
+			newMap := make(map[string]string)
+			for k, v := range envMap {
+				if k != key {
+					newMap[k] = v
+				}
+			}
+			saveToFile(newMap)
+		}
+
+		handleSave := func(key, value string) {
+			newMap := make(map[string]string)
+			for k, v := range envMap {
+				newMap[k] = v
+			}
+			newMap[key] = value
+			if saveToFile(newMap) {
+				setEditingKey("")
+				setHighlightKey(key)
+			}
+		}
+
+		handleCancel := func() {
+			setEditingKey("")
+		}
+
+		// Get sorted keys
+		var keys []string
+		for k := range resolved {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		// groups come from all keys so they stay stable while searching
+		var groups []KeyGroup
+		numShown := 0
+		for _, group := range groupKeys(keys) {
+			group.Keys = vdom.Filter(group.Keys, func(key string) bool {
+				exp := expansions[key]
+				return key == editingKey || matchesSearch(search, key, effective[key], exp.Value)
+			})
+			if len(group.Keys) > 0 {
+				groups = append(groups, group)
+				numShown += len(group.Keys)
+			}
+		}
+
+		makeItemProps := func(key string) EnvItemProps {
+			rk := resolved[key]
+			targetVal, inTarget := envMap[key]
+			itemProps := EnvItemProps{
+				Key:       key,
+				Value:     rk.Value,
+				EditValue: rk.Value,
+				Inherited: !inTarget,
+			}
+			if inTarget {
+				itemProps.EditValue = targetVal
+			}
+			snap := layerSnaps[rk.Source]
+			if rk.Source == props.Target {
+				snap = fileState.Current.GetBase()
+			}
+			if snap != nil {
+				itemProps.Encrypted = snap.isEncrypted(key)
+				itemProps.Locked = snap.Locked[key]
+			}
+			if isLayered {
+				itemProps.Source = layerName(props.Layers[rk.Source])
+				itemProps.Shadowed = rk.Shadowed
+			}
+			if exp := expansions[key]; exp != nil {
+				if exp.Value != rk.Value {
+					itemProps.Expanded = exp.Value
+				}
+				itemProps.RefIssues = exp.Issues()
+			}
+			itemProps.Expand = expand
+			itemProps.ReferencedBy = refsTo[key]
+			return itemProps
+		}
+
+		renderItem := func(key string) any {
+			itemProps := makeItemProps(key)
+			itemProps.OnEdit = func() { handleEdit(key) }
+			itemProps.OnDelete = func() { handleDelete(key) }
+			itemProps.OnSave = handleSave
+			itemProps.OnCancel = handleCancel
+			itemProps.IsEditing = key == editingKey
+			itemProps.Highlight = key == highlightKey
+			itemProps.Errors = validation.errorsFor(key)
+			itemProps.Unknown = validation.isUnknown(key)
+			itemProps.IsRef = editingKey != "" && slices.Contains(refsTo[editingKey], key)
+			return EnvItem(itemProps).WithKey(key)
+		}
+
+		return vdom.H("div", map[string]any{
+			"className": "env-editor",
+		},
+			Header(HeaderProps{
+				Path:        envPath,
+				OnAddNew:    handleAdd,
+				IsEditing:   editingKey != "",
+				CanUndo:     history.Current.CanUndo(),
+				CanRedo:     history.Current.CanRedo(),
+				OnUndo:      handleUndo,
+				OnRedo:      handleRedo,
+				OnBackups:   handleToggleBackups,
+				ShowBackups: showBackups,
+				OnImport:    func() { setShowImport(!showImport) },
+				ShowImport:  showImport,
+				OnShellEnv:  handleToggleShell,
+				ShowShell:   showShell,
+			}),
+
+			vdom.If(isLayered,
+				LayerTabs(LayerTabsProps{
+					Layers:   makeLayerInfos(props.Layers, envs),
+					Target:   props.Target,
+					OnSelect: props.OnTarget,
+				}),
+			),
+
+			vdom.If(error != "",
+				vdom.H("div", map[string]any{
+					"className": "env-error",
+				}, error),
+			),
+
+			vdom.If(diskChanged && mergeState == nil,
+				ChangeBanner(ChangeBannerProps{
+					OnReload:  handleReload,
+					OnMerge:   func() { startMerge(envMap) },
+					OnDismiss: func() { setDiskChanged(false) },
+				}),
+			),
+
+			mergeView,
+
+			schemaSummary,
+
+			vdom.If(len(lintIssues) > 0,
+				LintPanel(LintPanelProps{
+					Issues:   lintIssues,
+					Expanded: showLint,
+					OnToggle: func() { setShowLint(!showLint) },
+					OnFix:    handleLintFix,
+					OnFixAll: func() { applyLint(fixAllLint) },
+				}),
+			),
+
+			vdom.If(showShell,
+				ShellEnvView(ShellEnvViewProps{
+					ProcessDiff: diffProcessEnv(processEnv(), expandedEnv),
+					BlockDiff:   diffEnv(pickKeys(blockEnv, blockVars), blockVars),
+					BlockError:  blockError,
+					Secrets:     secretNames,
+					Status:      shellStatus,
+					OnApply:     handleApplyBlockEnv,
+					OnRefresh:   refreshBlockEnv,
+					OnClose:     handleToggleShell,
+				}),
+			),
+
+			vdom.If(showImport,
+				ImportView(ImportViewProps{
+					Current: envMap,
+					OnApply: handleImport,
+					OnClose: func() { setShowImport(false) },
+				}),
+			),
+
+			SearchBar(SearchBarProps{
+				Value:    search,
+				OnChange: setSearch,
+				NumShown: numShown,
+				NumTotal: len(keys),
+			}),
+
+			vdom.If(showBackups,
+				BackupView(BackupViewProps{
+					Backups:   backups,
+					Selected:  selectedBackup,
+					Diff:      diffEnv(envMap, backupMap),
+					OnSelect:  handleSelectBackup,
+					OnRestore: handleRestoreBackup,
+					OnClose:   handleToggleBackups,
+				}),
+			),
+
+			vdom.H("div", map[string]any{
+				"className": "env-list",
+			},
+				vdom.ForEach(groups, func(group KeyGroup) any {
+					isCollapsed := collapsed[group.Prefix] && search == ""
+					return vdom.H("div", map[string]any{
+						"key":       "group:" + group.Prefix,
+						"className": "env-group",
+					},
+						vdom.If(group.Prefix != "",
+							GroupHeader(GroupHeaderProps{
+								Prefix:    group.Prefix,
+								Count:     len(group.Keys),
+								Collapsed: isCollapsed,
+								OnToggle:  func() { toggleGroup(group.Prefix) },
+							}),
+						),
+						vdom.If(!isCollapsed, vdom.ForEach(group.Keys, renderItem)),
+					)
+				}),
+				// Add new item form at bottom
+				vdom.If(editingKey == "__new__",
+					EditForm(EditFormProps{
+						Key:      "",
+						Value:    "",
+						IsNew:    true,
+						OnSave:   handleSave,
+						OnCancel: handleCancel,
+						Expand:   expand,
+					}),
+				),
+			),
+		)
+	},
+)
+
+// resolveArgs builds the layer stack from the command line: several files
+// (lowest precedence first), a directory (the .env/.env.local/.env.<mode>
+// stack) or a single file
+func resolveArgs(args []string, mode string) ([]string, error) {
+	if len(args) == 1 {
+		if info, err := os.Stat(args[0]); err == nil && info.IsDir() {
+			return modeLayers(args[0], mode), nil
+		}
+	}
+	if mode != "" {
+		return nil, fmt.Errorf("-mode requires a directory argument")
+	}
+	return args, nil
+}
+
+func main() {
+	AppClient.RegisterDefaultFlags()
+	args, numBeforeDash := parseArgs(os.Args[1:])
+
+	if len(args) > 0 && numBeforeDash != 0 {
+		if _, ok := cliCommands[args[0]]; ok {
+			os.Exit(runCli(args))
+		}
+	}
+
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: env-editor [flags] [--] <env-file-path | directory> [<env-file-path>...]\n")
+		fmt.Fprintf(os.Stderr, "Multiple files are layered, later files override earlier ones.\n")
+		fmt.Fprintf(os.Stderr, "Use -- before a file named like a command.\n")
+		printCliUsage()
+		flag.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	envLayers, err = resolveArgs(args, *modeFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := checkLayerDirs(envLayers); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	initialTarget, err = pickTarget(envLayers, *targetFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 
-	// Verify directory exists
-	dir := filepath.Dir(envPath)
-	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
-		fmt.Fprintf(os.Stderr, "Directory does not exist: %s\n", dir)
+	envSchema, err = loadSchema(envLayers[0], *schemaPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading schema: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/envutil"
+)
+
+const defaultFileMode os.FileMode = 0644
+
+const (
+	FormatNul    = "nul"    // KEY=VALUE\0 as used by Wave (see envutil), the default
+	FormatDotenv = "dotenv" // KEY=VALUE lines (see dotenv.go)
+)
+
+// EnvSnapshot is the env file as it was last read from or written to disk.
+// It serves as the merge base when the file changes underneath the editor.
+type EnvSnapshot struct {
+	Env     map[string]string // decrypted values
+	Stored  map[string]string // values as written in the file (see crypt.go)
+	Literal map[string]bool   // single quoted dotenv values, not interpolated
+	Locked  map[string]string // encrypted values that could not be decrypted, with the reason
+	Content string
+	Format  string
+	Hash    string
+	ModTime time.Time
+	Size    int64
+	Mode    os.FileMode
+	Exists  bool
+}
+
+// FileState is shared between the render loop and the file watcher goroutine
+type FileState struct {
+	Lock sync.Mutex
+	Base *EnvSnapshot // last version we loaded or wrote
+	Disk *EnvSnapshot // newer version found on disk (nil if none)
+}
+
+func (state *FileState) GetBase() *EnvSnapshot {
+	state.Lock.Lock()
+	defer state.Lock.Unlock()
+	return state.Base
+}
+
+func (state *FileState) SetBase(snap *EnvSnapshot) {
+	state.Lock.Lock()
+	defer state.Lock.Unlock()
+	state.Base = snap
+	state.Disk = nil
+}
+
+func (state *FileState) GetDisk() *EnvSnapshot {
+	state.Lock.Lock()
+	defer state.Lock.Unlock()
+	return state.Disk
+}
+
+func (state *FileState) SetDisk(snap *EnvSnapshot) {
+	state.Lock.Lock()
+	defer state.Lock.Unlock()
+	state.Disk = snap
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// detectFormat decides between Wave's NUL separated format and dotenv. NUL
+// stays the default so envutil files keep their format on disk, a file is
+// only read and written as dotenv when it clearly is one: it has a dotenv
+// name (".env", ".env.local", "app.env") or, without NUL bytes, comments or
+// several KEY=VALUE lines.
+func detectFormat(path string, content string) string {
+	if strings.Contains(content, "\x00") {
+		return FormatNul
+	}
+	if isDotenvName(filepath.Base(path)) || looksLikeDotenv(content) {
+		return FormatDotenv
+	}
+	return FormatNul
+}
+
+func isDotenvName(name string) bool {
+	return name == ".env" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env")
+}
+
+// looksLikeDotenv reports whether every line of content is blank, a comment
+// or part of an assignment, with at least a comment or two assignments. A
+// single line could just as well be one NUL record with a trailing newline.
+func looksLikeDotenv(content string) bool {
+	lines := splitLines(content)
+	covered := make([]bool, len(lines))
+	entries := parseDotenvEntries(content)
+	for _, entry := range entries {
+		for idx := entry.StartLine; idx <= entry.EndLine; idx++ {
+			covered[idx] = true
+		}
+	}
+	hasComment := false
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case covered[idx], line == "":
+		case strings.HasPrefix(line, "#"):
+			hasComment = true
+		default:
+			return false
+		}
+	}
+	return hasComment || len(entries) > 1
+}
+
+func parseEnv(content string, format string) map[string]string {
+	if format == FormatDotenv {
+		return parseDotenv(content)
+	}
+	return envutil.EnvToMap(content)
+}
+
+// formatEnv serializes envMap, using orig as a template to keep the
+// layout and comments of dotenv files
+func formatEnv(orig string, envMap map[string]string, format string) string {
+	if format == FormatDotenv {
+		return formatDotenv(orig, envMap)
+	}
+	return envutil.MapToEnv(envMap)
+}
+
+func makeSnapshot(path string, content []byte, info os.FileInfo) (*EnvSnapshot, error) {
+	format := detectFormat(path, string(content))
+	stored := parseEnv(string(content), format)
+	env, locked := decryptEnv(stored)
+	var literal map[string]bool
+	if format == FormatDotenv {
+		literal = literalDotenvKeys(string(content))
+	}
+	return &EnvSnapshot{
+		Env:     env,
+		Stored:  stored,
+		Literal: literal,
+		Locked:  locked,
+		Content: string(content),
+		Format:  format,
+		Hash:    hashContent(content),
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Mode:    info.Mode().Perm(),
+		Exists:  true,
+	}, nil
+}
+
+// readSnapshot reads the env file, a missing file is an empty snapshot
+func readSnapshot(path string) (*EnvSnapshot, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return &EnvSnapshot{Env: map[string]string{}, Stored: map[string]string{}, Format: detectFormat(path, ""), Mode: defaultFileMode}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return makeSnapshot(path, content, info)
+}
+
+// unchanged is a cheap check (no read) that the file still matches the snapshot
+func (s *EnvSnapshot) unchanged(path string) bool {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return !s.Exists
+	}
+	if err != nil {
+		return true
+	}
+	return s.Exists && info.ModTime().Equal(s.ModTime) && info.Size() == s.Size
+}
+
+// sameContent reports whether two snapshots hold the same bytes
+func (s *EnvSnapshot) sameContent(other *EnvSnapshot) bool {
+	return s.Exists == other.Exists && s.Hash == other.Hash
+}
+
+// writeFileAtomic writes to a temp file in the same directory and renames it
+// over path, so readers never observe a partially written file. A symlinked
+// path is resolved first so the link stays and its target is replaced.
+func writeFileAtomic(path string, content []byte, mode os.FileMode) (rtnErr error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() {
+		if rtnErr != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(content); err != nil {
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("syncing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("renaming temp file: %w", err)
+	}
+	return nil
+}
+
+// snapshotWriter writes the file, returning the snapshot of what it wrote
+type snapshotWriter func() (*EnvSnapshot, error)
+
+// writeSnapshot atomically writes envMap in the format (and with the mode) of
+// tmpl and returns the resulting snapshot. Values are encrypted before
+// formatting, plaintext of encrypted files is never written.
+func writeSnapshot(path string, tmpl *EnvSnapshot, envMap map[string]string) (*EnvSnapshot, error) {
+	stored, err := encryptChanged(tmpl, envMap)
+	if err != nil {
+		return nil, err
+	}
+	return writeContent(path, []byte(formatEnv(tmpl.Content, stored, tmpl.Format)), tmpl.Mode)
+}
+
+func mapWriter(path string, tmpl *EnvSnapshot, envMap map[string]string) snapshotWriter {
+	return func() (*EnvSnapshot, error) {
+		return writeSnapshot(path, tmpl, envMap)
+	}
+}
+
+func contentWriter(path string, content []byte, mode os.FileMode) snapshotWriter {
+	return func() (*EnvSnapshot, error) {
+		return writeContent(path, content, mode)
+	}
+}
+
+// writeContent atomically writes content as is and returns the resulting
+// snapshot
+func writeContent(path string, content []byte, mode os.FileMode) (*EnvSnapshot, error) {
+	if err := writeFileAtomic(path, content, mode); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return makeSnapshot(path, content, info)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.env")
+	link := filepath.Join(dir, ".env")
+	if err := os.WriteFile(target, []byte("A=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := writeFileAtomic(link, []byte("A=2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s was replaced by a regular file", link)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "A=2\n" {
+		t.Errorf("target holds %q, want %q", content, "A=2\n")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		content string
+		want    string
+	}{
+		{"env", "A=1\x00B=2\x00", FormatNul},
+		{"env", "", FormatNul},
+		{"env", "A=1\n", FormatNul},
+		{"env", "A=1\nB=2\n", FormatDotenv},
+		{"env", "# comment\nA=1\n", FormatDotenv},
+		{"env", "A=\"multi\nline\"\nB=2\n", FormatDotenv},
+		{"env", "A=1\nnot an assignment\n", FormatNul},
+		{".env", "", FormatDotenv},
+		{".env.local", "A=1", FormatDotenv},
+		{"app.env", "", FormatDotenv},
+		{".env", "A=1\x00", FormatNul},
+	}
+	for _, tt := range tests {
+		if got := detectFormat(tt.path, tt.content); got != tt.want {
+			t.Errorf("detectFormat(%q, %q) = %q, want %q", tt.path, tt.content, got, tt.want)
+		}
+	}
+}
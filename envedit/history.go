@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+)
+
+const maxHistory = 100
+
+// FileVersion is the raw content of the file at some point. Exists is false
+// for the version before the file was created.
+type FileVersion struct {
+	Content []byte
+	Exists  bool
+}
+
+func readVersion(path string) (FileVersion, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return FileVersion{}, nil
+	}
+	if err != nil {
+		return FileVersion{}, err
+	}
+	return FileVersion{Content: content, Exists: true}, nil
+}
+
+// versionWriter puts ver back byte for byte, removing the file for the
+// version before it was created
+func versionWriter(path string, ver FileVersion, mode os.FileMode) snapshotWriter {
+	if ver.Exists {
+		return contentWriter(path, ver.Content, mode)
+	}
+	return func() (*EnvSnapshot, error) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return readSnapshot(path)
+	}
+}
+
+// EditHistory keeps the file contents before (Undo) and after (Redo) each
+// write. Versions are restored byte for byte, so undo gives exactly the
+// earlier file (comments, order and encrypted values included).
+type EditHistory struct {
+	Undo      []FileVersion
+	Redo      []FileVersion
+	replaying bool
+}
+
+func (h *EditHistory) CanUndo() bool {
+	return len(h.Undo) > 0
+}
+
+func (h *EditHistory) CanRedo() bool {
+	return len(h.Redo) > 0
+}
+
+// Record is called after every write with the version it replaced.
+// Writes done by StepUndo/StepRedo themselves are not recorded.
+func (h *EditHistory) Record(prev FileVersion) {
+	if h.replaying {
+		return
+	}
+	h.Undo = append(h.Undo, prev)
+	if len(h.Undo) > maxHistory {
+		h.Undo = h.Undo[len(h.Undo)-maxHistory:]
+	}
+	h.Redo = nil
+}
+
+// StepUndo restores the previous version, moving current onto the redo stack
+func (h *EditHistory) StepUndo(current FileVersion, restore func(FileVersion) bool) {
+	if !h.CanUndo() {
+		return
+	}
+	if h.replay(h.Undo[len(h.Undo)-1], restore) {
+		h.Undo = h.Undo[:len(h.Undo)-1]
+		h.Redo = append(h.Redo, current)
+	}
+}
+
+// StepRedo restores the most recently undone version, moving current onto the undo stack
+func (h *EditHistory) StepRedo(current FileVersion, restore func(FileVersion) bool) {
+	if !h.CanRedo() {
+		return
+	}
+	if h.replay(h.Redo[len(h.Redo)-1], restore) {
+		h.Redo = h.Redo[:len(h.Redo)-1]
+		h.Undo = append(h.Undo, current)
+	}
+}
+
+func (h *EditHistory) replay(ver FileVersion, restore func(FileVersion) bool) bool {
+	h.replaying = true
+	defer func() {
+		h.replaying = false
+	}()
+	return restore(ver)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	ImportAdd      = "add"
+	ImportChange   = "change"
+	ImportSame     = "same"
+	ImportConflict = "conflict"
+)
+
+// ImportRow is one key of a pasted KEY=VALUE block
+type ImportRow struct {
+	Key    string   `json:"key"`
+	Kind   string   `json:"kind"`
+	Old    string   `json:"old"`
+	New    string   `json:"new"`
+	Values []string `json:"values"` // every value pasted for the key (conflicts)
+	Exists bool     `json:"exists"`
+}
+
+type ImportPlan struct {
+	Rows    []ImportRow `json:"rows"`
+	Invalid []string    `json:"invalid"` // lines that are not KEY=VALUE
+}
+
+// planImport parses text (dotenv syntax) and classifies each key against
+// current. A key pasted more than once with different values is a conflict,
+// the last value wins (as it would when loading the file).
+func planImport(text string, current map[string]string) ImportPlan {
+	var plan ImportPlan
+	entries := parseDotenvEntries(text)
+	used := make(map[int]bool)
+	values := make(map[string][]string)
+	var order []string
+	for _, entry := range entries {
+		for line := entry.StartLine; line <= entry.EndLine; line++ {
+			used[line] = true
+		}
+		if _, ok := values[entry.Key]; !ok {
+			order = append(order, entry.Key)
+		}
+		values[entry.Key] = append(values[entry.Key], entry.Value)
+	}
+	for idx, line := range splitLines(text) {
+		line = strings.TrimSpace(line)
+		if used[idx] || line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		plan.Invalid = append(plan.Invalid, line)
+	}
+	sort.Strings(order)
+	for _, key := range order {
+		vals := values[key]
+		oldVal, exists := current[key]
+		row := ImportRow{
+			Key:    key,
+			Old:    oldVal,
+			New:    vals[len(vals)-1],
+			Exists: exists,
+		}
+		switch {
+		case hasDistinct(vals):
+			row.Kind = ImportConflict
+			row.Values = vals
+		case !exists:
+			row.Kind = ImportAdd
+		case oldVal == row.New:
+			row.Kind = ImportSame
+		default:
+			row.Kind = ImportChange
+		}
+		plan.Rows = append(plan.Rows, row)
+	}
+	return plan
+}
+
+func hasDistinct(vals []string) bool {
+	for _, v := range vals {
+		if v != vals[0] {
+			return true
+		}
+	}
+	return false
+}
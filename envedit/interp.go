@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Interpolation follows docker-compose / dotenv:
+// $VAR and ${VAR} expand to the value of VAR ("" if unset)
+// ${VAR:-default} / ${VAR-default} use default if VAR is unset or empty / unset
+// ${VAR:?error} / ${VAR?error} fail if VAR is unset or empty / unset
+// ${VAR:+alt} / ${VAR+alt} use alt if VAR is set and non-empty / set
+// $$ is a literal "$"
+// Variables not defined in the file(s) fall back to the process environment.
+// 'single quoted' dotenv values are literal and never expanded.
+
+// Expansion is the result of interpolating one value
+type Expansion struct {
+	Value     string   `json:"value"`
+	Refs      []string `json:"refs"`
+	Undefined []string `json:"undefined"`
+	Errors    []string `json:"errors"`
+}
+
+func (exp *Expansion) HasIssues() bool {
+	return len(exp.Undefined) > 0 || len(exp.Errors) > 0
+}
+
+// Issues returns the undefined references and errors as display messages
+func (exp *Expansion) Issues() []string {
+	var rtn []string
+	for _, name := range exp.Undefined {
+		rtn = append(rtn, fmt.Sprintf("references undefined variable %s", name))
+	}
+	return append(rtn, exp.Errors...)
+}
+
+type interpolator struct {
+	env     map[string]string
+	literal map[string]bool // keys whose values are not expanded
+	cache   map[string]string
+	stack   []string
+	inCycle bool
+}
+
+func isVarStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isVarChar(ch byte) bool {
+	return isVarStart(ch) || (ch >= '0' && ch <= '9')
+}
+
+func addUnique(list []string, val string) []string {
+	for _, v := range list {
+		if v == val {
+			return list
+		}
+	}
+	return append(list, val)
+}
+
+// findBraceEnd returns the index of the "}" closing the "${" at start,
+// skipping over nested ${...} in defaults
+func findBraceEnd(val string, start int) int {
+	depth := 0
+	for i := start; i < len(val); i++ {
+		switch {
+		case val[i] == '$' && i+1 < len(val) && val[i+1] == '{':
+			depth++
+			i++
+		case val[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// lookupVar returns the fully expanded value of name
+func (ip *interpolator) lookupVar(name string, exp *Expansion) (string, bool) {
+	raw, ok := ip.env[name]
+	if !ok {
+		return os.LookupEnv(name)
+	}
+	if ip.literal[name] {
+		return raw, true
+	}
+	if cached, ok := ip.cache[name]; ok {
+		return cached, true
+	}
+	for idx, stackName := range ip.stack {
+		if stackName == name {
+			cycle := append(append([]string{}, ip.stack[idx:]...), name)
+			exp.Errors = addUnique(exp.Errors, "reference cycle: "+strings.Join(cycle, " -> "))
+			ip.inCycle = true
+			return "", true
+		}
+	}
+	ip.stack = append(ip.stack, name)
+	// problems inside referenced values are reported on those keys, not here
+	inner := &Expansion{}
+	val := ip.expand(raw, inner)
+	for _, msg := range inner.Errors {
+		if strings.HasPrefix(msg, "reference cycle") {
+			exp.Errors = addUnique(exp.Errors, msg)
+		}
+	}
+	ip.stack = ip.stack[:len(ip.stack)-1]
+	if !ip.inCycle {
+		ip.cache[name] = val
+	}
+	return val, true
+}
+
+func (ip *interpolator) expandRef(expr string, exp *Expansion) string {
+	nameEnd := 0
+	for nameEnd < len(expr) && isVarChar(expr[nameEnd]) {
+		nameEnd++
+	}
+	name := expr[:nameEnd]
+	if name == "" || !isVarStart(name[0]) {
+		exp.Errors = addUnique(exp.Errors, fmt.Sprintf("invalid reference ${%s}", expr))
+		return ""
+	}
+	exp.Refs = addUnique(exp.Refs, name)
+	rest := expr[nameEnd:]
+	op := ""
+	for _, candidate := range []string{":-", ":?", ":+", "-", "?", "+"} {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" && rest != "" {
+		exp.Errors = addUnique(exp.Errors, fmt.Sprintf("invalid reference ${%s}", expr))
+		return ""
+	}
+	arg := rest[len(op):]
+	val, isSet := ip.lookupVar(name, exp)
+	isSetNonEmpty := isSet && val != ""
+	switch op {
+	case "":
+		if !isSet {
+			exp.Undefined = addUnique(exp.Undefined, name)
+		}
+		return val
+	case ":-", "-":
+		if (op == ":-" && !isSetNonEmpty) || (op == "-" && !isSet) {
+			return ip.expand(arg, exp)
+		}
+		return val
+	case ":?", "?":
+		if (op == ":?" && !isSetNonEmpty) || (op == "?" && !isSet) {
+			msg := ip.expand(arg, exp)
+			if msg == "" {
+				msg = "is required"
+			}
+			exp.Errors = addUnique(exp.Errors, fmt.Sprintf("%s: %s", name, msg))
+		}
+		return val
+	default: // ":+", "+"
+		if (op == ":+" && isSetNonEmpty) || (op == "+" && isSet) {
+			return ip.expand(arg, exp)
+		}
+		return ""
+	}
+}
+
+func (ip *interpolator) expand(val string, exp *Expansion) string {
+	var sb strings.Builder
+	for i := 0; i < len(val); i++ {
+		ch := val[i]
+		if ch != '$' || i+1 >= len(val) {
+			sb.WriteByte(ch)
+			continue
+		}
+		next := val[i+1]
+		switch {
+		case next == '$':
+			sb.WriteByte('$')
+			i++
+		case next == '{':
+			end := findBraceEnd(val, i)
+			if end < 0 {
+				exp.Errors = addUnique(exp.Errors, "unterminated ${")
+				sb.WriteString(val[i:])
+				return sb.String()
+			}
+			sb.WriteString(ip.expandRef(val[i+2:end], exp))
+			i = end
+		case isVarStart(next):
+			end := i + 1
+			for end < len(val) && isVarChar(val[end]) {
+				end++
+			}
+			sb.WriteString(ip.expandRef(val[i+1:end], exp))
+			i = end - 1
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+func makeInterpolator(env map[string]string, literal map[string]bool) *interpolator {
+	return &interpolator{env: env, literal: literal, cache: make(map[string]string)}
+}
+
+// expandTop expands the value of key, a self reference is reported as a cycle
+func (ip *interpolator) expandTop(key string, val string) *Expansion {
+	ip.stack = nil
+	if key != "" {
+		ip.stack = []string{key}
+	}
+	ip.inCycle = false
+	exp := &Expansion{}
+	if ip.literal[key] {
+		exp.Value = val
+		return exp
+	}
+	exp.Value = ip.expand(val, exp)
+	return exp
+}
+
+// expandValue interpolates a single value against env, used to preview
+// values that are not saved yet
+func expandValue(key string, val string, env map[string]string, literal map[string]bool) *Expansion {
+	return makeInterpolator(env, literal).expandTop(key, val)
+}
+
+// expandAll interpolates every value of env, except the literal ones
+func expandAll(env map[string]string, literal map[string]bool) map[string]*Expansion {
+	ip := makeInterpolator(env, literal)
+	rtn := make(map[string]*Expansion)
+	for key, val := range env {
+		rtn[key] = ip.expandTop(key, val)
+	}
+	return rtn
+}
+
+// referencedBy maps each variable to the keys whose values reference it
+func referencedBy(expansions map[string]*Expansion) map[string][]string {
+	rtn := make(map[string][]string)
+	for key, exp := range expansions {
+		for _, ref := range exp.Refs {
+			rtn[ref] = append(rtn[ref], key)
+		}
+	}
+	for _, keys := range rtn {
+		sort.Strings(keys)
+	}
+	return rtn
+}
+
+// expandedValues returns just the interpolated values
+func expandedValues(expansions map[string]*Expansion) map[string]string {
+	rtn := make(map[string]string)
+	for key, exp := range expansions {
+		rtn[key] = exp.Value
+	}
+	return rtn
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandValue(t *testing.T) {
+	env := map[string]string{
+		"HOST":  "localhost",
+		"PORT":  "8080",
+		"EMPTY": "",
+		"URL":   "http://${HOST}:$PORT",
+	}
+	tests := []struct {
+		val       string
+		want      string
+		undefined []string
+		errors    []string
+	}{
+		{"plain", "plain", nil, nil},
+		{"$HOST", "localhost", nil, nil},
+		{"${HOST}:${PORT}", "localhost:8080", nil, nil},
+		{"$HOST.example", "localhost.example", nil, nil},
+		{"$$HOST", "$HOST", nil, nil},
+		{"cost $5", "cost $5", nil, nil},
+		{"trailing $", "trailing $", nil, nil},
+		{"${URL}/api", "http://localhost:8080/api", nil, nil},
+		{"${ENVEDIT_TEST_UNSET}", "", []string{"ENVEDIT_TEST_UNSET"}, nil},
+
+		{"${EMPTY:-dflt}", "dflt", nil, nil},
+		{"${EMPTY-dflt}", "", nil, nil},
+		{"${ENVEDIT_TEST_UNSET:-dflt}", "dflt", nil, nil},
+		{"${ENVEDIT_TEST_UNSET-dflt}", "dflt", nil, nil},
+		{"${HOST:-dflt}", "localhost", nil, nil},
+		{"${ENVEDIT_TEST_UNSET:-${HOST}:${PORT}}", "localhost:8080", nil, nil},
+
+		{"${EMPTY:+alt}", "", nil, nil},
+		{"${EMPTY+alt}", "alt", nil, nil},
+		{"${HOST:+alt}", "alt", nil, nil},
+		{"${ENVEDIT_TEST_UNSET+alt}", "", nil, nil},
+
+		{"${HOST:?missing}", "localhost", nil, nil},
+		{"${EMPTY?missing}", "", nil, nil},
+		{"${EMPTY:?missing}", "", nil, []string{"EMPTY: missing"}},
+		{"${ENVEDIT_TEST_UNSET?}", "", nil, []string{"ENVEDIT_TEST_UNSET: is required"}},
+
+		{"${1BAD}", "", nil, []string{"invalid reference ${1BAD}"}},
+		{"${HOST!x}", "", nil, []string{"invalid reference ${HOST!x}"}},
+		{"${HOST", "${HOST", nil, []string{"unterminated ${"}},
+	}
+	for _, tt := range tests {
+		exp := expandValue("KEY", tt.val, env, nil)
+		if exp.Value != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.val, exp.Value, tt.want)
+		}
+		if !reflect.DeepEqual(exp.Undefined, tt.undefined) {
+			t.Errorf("%q: undefined %v, want %v", tt.val, exp.Undefined, tt.undefined)
+		}
+		if !reflect.DeepEqual(exp.Errors, tt.errors) {
+			t.Errorf("%q: errors %v, want %v", tt.val, exp.Errors, tt.errors)
+		}
+	}
+}
+
+func TestExpandLiteral(t *testing.T) {
+	content := "HOST=localhost\nRAW='${HOST}:$$'\nURL=\"${RAW}/x\"\n"
+	env := parseDotenv(content)
+	literal := literalDotenvKeys(content)
+	if !literal["RAW"] || literal["URL"] || literal["HOST"] {
+		t.Fatalf("literal keys: got %v, want only RAW", literal)
+	}
+	exps := expandAll(env, literal)
+	if got, want := exps["RAW"].Value, "${HOST}:$$"; got != want {
+		t.Errorf("RAW: got %q, want %q", got, want)
+	}
+	// a reference to a literal value takes it as is
+	if got, want := exps["URL"].Value, "${HOST}:$$/x"; got != want {
+		t.Errorf("URL: got %q, want %q", got, want)
+	}
+	if len(exps["RAW"].Refs) != 0 {
+		t.Errorf("RAW: got refs %v, want none", exps["RAW"].Refs)
+	}
+}
+
+func TestExpandCycle(t *testing.T) {
+	env := map[string]string{
+		"A":    "${B}",
+		"B":    "x${C}",
+		"C":    "$A",
+		"SELF": "${SELF}/bin",
+		"D":    "${A}",
+		"OK":   "fine",
+	}
+	exps := expandAll(env, nil)
+	for _, key := range []string{"A", "B", "C", "SELF", "D"} {
+		found := false
+		for _, msg := range exps[key].Errors {
+			if strings.HasPrefix(msg, "reference cycle: ") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no cycle reported, errors %v", key, exps[key].Errors)
+		}
+	}
+	if got, want := exps["SELF"].Errors, []string{"reference cycle: SELF -> SELF"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SELF: got %v, want %v", got, want)
+	}
+	if exps["OK"].HasIssues() {
+		t.Errorf("OK: unexpected issues %v", exps["OK"].Issues())
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// LayerValue is the value a key has in one file of the layer stack
+type LayerValue struct {
+	Layer string `json:"layer"`
+	Value string `json:"value"`
+}
+
+// ResolvedKey is the effective value of a key across the layer stack
+type ResolvedKey struct {
+	Value    string       // effective value
+	Source   int          // index of the layer the effective value comes from
+	Shadowed []LayerValue // overridden values of lower layers, highest first
+}
+
+// LayerInfo describes one file of the stack for display
+type LayerInfo struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	Count  int    `json:"count"`
+}
+
+func layerName(path string) string {
+	return filepath.Base(path)
+}
+
+// modeLayers is the conventional dotenv stack for a directory, lowest
+// precedence first: .env, .env.local, .env.<mode>, .env.<mode>.local
+func modeLayers(dir string, mode string) []string {
+	names := []string{".env", ".env.local"}
+	if mode != "" {
+		names = append(names, ".env."+mode, ".env."+mode+".local")
+	}
+	var rtn []string
+	for _, name := range names {
+		rtn = append(rtn, filepath.Join(dir, name))
+	}
+	return rtn
+}
+
+// resolveLayers computes the effective value of every key. paths and envs
+// are ordered from lowest to highest precedence.
+func resolveLayers(paths []string, envs []map[string]string) map[string]*ResolvedKey {
+	rtn := make(map[string]*ResolvedKey)
+	for idx := len(envs) - 1; idx >= 0; idx-- {
+		for key, val := range envs[idx] {
+			rk := rtn[key]
+			if rk == nil {
+				rtn[key] = &ResolvedKey{Value: val, Source: idx}
+				continue
+			}
+			rk.Shadowed = append(rk.Shadowed, LayerValue{Layer: layerName(paths[idx]), Value: val})
+		}
+	}
+	return rtn
+}
+
+// effectiveEnv flattens the resolved stack to plain key/values
+func effectiveEnv(resolved map[string]*ResolvedKey) map[string]string {
+	rtn := make(map[string]string)
+	for key, rk := range resolved {
+		rtn[key] = rk.Value
+	}
+	return rtn
+}
+
+// literalKeys returns the keys whose effective value is single quoted in
+// the layer it comes from. snaps may have nil entries (unreadable layers).
+func literalKeys(resolved map[string]*ResolvedKey, snaps []*EnvSnapshot) map[string]bool {
+	rtn := make(map[string]bool)
+	for key, rk := range resolved {
+		snap := snaps[rk.Source]
+		// an unsaved edit of the value is not what the file quotes
+		if snap != nil && snap.Literal[key] && snap.Env[key] == rk.Value {
+			rtn[key] = true
+		}
+	}
+	return rtn
+}
+
+func makeLayerInfos(paths []string, envs []map[string]string) []LayerInfo {
+	var rtn []LayerInfo
+	for idx, path := range paths {
+		_, err := os.Stat(path)
+		rtn = append(rtn, LayerInfo{
+			Name:   layerName(path),
+			Path:   path,
+			Exists: err == nil,
+			Count:  len(envs[idx]),
+		})
+	}
+	return rtn
+}
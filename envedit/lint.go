@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	LintDuplicate    = "duplicate"
+	LintInvalidKey   = "invalid-key"
+	LintTrailing     = "trailing-space"
+	LintCRLF         = "crlf"
+	LintUnterminated = "unterminated"
+)
+
+// maxFixPasses bounds "fix all", closing a quote can uncover lines that
+// were swallowed by the quoted value and need another pass
+const maxFixPasses = 5
+
+var validKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var invalidKeyCharRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// LintIssue is a problem found in the file text that the parsed map hides.
+// Lines are 1-based, Line is 0 for issues about the whole file.
+type LintIssue struct {
+	Kind    string `json:"kind"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"endLine"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+	Fix     string `json:"fix"` // description of the quick fix, "" if there is none
+	NewKey  string `json:"newKey"`
+	Quote   string `json:"quote"`
+}
+
+func recordSep(format string) string {
+	if format == FormatNul {
+		return "\x00"
+	}
+	return "\n"
+}
+
+// splitRecords splits content into lines (dotenv) or KEY=VALUE records (nul)
+func splitRecords(content string, format string) []string {
+	records := strings.Split(content, recordSep(format))
+	if len(records) > 0 && records[len(records)-1] == "" {
+		records = records[:len(records)-1]
+	}
+	return records
+}
+
+func joinRecords(records []string, format string) string {
+	if len(records) == 0 {
+		return ""
+	}
+	sep := recordSep(format)
+	return strings.Join(records, sep) + sep
+}
+
+// lintEntries returns the assignments in file order, for the nul format
+// every record is one "line"
+func lintEntries(content string, format string) []EnvEntry {
+	if format == FormatDotenv {
+		return parseDotenvEntries(content)
+	}
+	var rtn []EnvEntry
+	for idx, record := range splitRecords(content, format) {
+		key, val, ok := strings.Cut(record, "=")
+		if !ok {
+			continue
+		}
+		rtn = append(rtn, EnvEntry{Key: key, Value: val, StartLine: idx, EndLine: idx})
+	}
+	return rtn
+}
+
+// sanitizeKey turns an invalid key into a valid one, "" if there is nothing left
+func sanitizeKey(key string) string {
+	key = invalidKeyCharRe.ReplaceAllString(strings.TrimSpace(key), "_")
+	if strings.Trim(key, "_") == "" {
+		return ""
+	}
+	if key[0] >= '0' && key[0] <= '9' {
+		key = "_" + key
+	}
+	return key
+}
+
+// lintEnv checks the raw file content for duplicates, invalid keys,
+// trailing whitespace, CRLF line endings and unterminated quotes
+func lintEnv(content string, format string) []LintIssue {
+	var issues []LintIssue
+	records := splitRecords(content, format)
+	entries := lintEntries(content, format)
+
+	winner := make(map[string]int)
+	for idx, entry := range entries {
+		winner[entry.Key] = idx
+	}
+	// lines that belong to a multi-line or unterminated value, trailing
+	// spaces there are part of the value
+	inValue := make(map[int]bool)
+	renamed := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.EndLine > entry.StartLine || entry.Unterminated {
+			for line := entry.StartLine; line <= entry.EndLine; line++ {
+				inValue[line] = true
+			}
+		}
+		if win := entries[winner[entry.Key]]; win.StartLine != entry.StartLine {
+			issues = append(issues, LintIssue{
+				Kind:    LintDuplicate,
+				Line:    entry.StartLine + 1,
+				EndLine: entry.EndLine + 1,
+				Key:     entry.Key,
+				Message: fmt.Sprintf("%s is assigned again on line %d, which wins", entry.Key, win.StartLine+1),
+				Fix:     "remove this assignment",
+			})
+		} else if !validKeyRe.MatchString(entry.Key) {
+			issue := LintIssue{
+				Kind:    LintInvalidKey,
+				Line:    entry.StartLine + 1,
+				EndLine: entry.EndLine + 1,
+				Key:     entry.Key,
+				Message: fmt.Sprintf("%q is not a valid variable name (letters, digits and _, not starting with a digit)", entry.Key),
+			}
+			newKey := sanitizeKey(entry.Key)
+			if _, exists := winner[newKey]; newKey != "" && !exists && !renamed[newKey] {
+				renamed[newKey] = true
+				issue.NewKey = newKey
+				issue.Fix = "rename to " + newKey
+			}
+			issues = append(issues, issue)
+		}
+		if entry.Unterminated {
+			msg := fmt.Sprintf("unterminated %c quote", entry.Quote)
+			if entry.EndLine > entry.StartLine {
+				msg += fmt.Sprintf(", the value runs to line %d", entry.EndLine+1)
+			}
+			issues = append(issues, LintIssue{
+				Kind:    LintUnterminated,
+				Line:    entry.StartLine + 1,
+				EndLine: entry.EndLine + 1,
+				Key:     entry.Key,
+				Message: msg,
+				Fix:     "close the quote at the end of the line",
+				Quote:   string(entry.Quote),
+			})
+		}
+	}
+
+	numCRLF := 0
+	for idx, record := range records {
+		body := record
+		if strings.HasSuffix(body, "\r") {
+			numCRLF++
+			body = strings.TrimSuffix(body, "\r")
+		}
+		if inValue[idx] || body == strings.TrimRight(body, " \t") {
+			continue
+		}
+		issue := LintIssue{
+			Kind:    LintTrailing,
+			Line:    idx + 1,
+			EndLine: idx + 1,
+			Message: "trailing whitespace",
+			Fix:     "trim",
+		}
+		if format == FormatNul {
+			// no fix, trimming would change the value
+			issue.Message = "trailing whitespace is part of the value"
+			issue.Fix = ""
+		}
+		issues = append(issues, issue)
+	}
+	if numCRLF > 0 {
+		issues = append(issues, LintIssue{
+			Kind:    LintCRLF,
+			Message: fmt.Sprintf("%d line(s) end with CRLF", numCRLF),
+			Fix:     "convert to LF",
+		})
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// renameRecord replaces the key of the assignment in record
+func renameRecord(record string, oldKey string, newKey string) string {
+	eqIdx := strings.IndexByte(record, '=')
+	if eqIdx < 0 {
+		return record
+	}
+	keyIdx := strings.LastIndex(record[:eqIdx], oldKey)
+	if keyIdx < 0 {
+		return record
+	}
+	return record[:keyIdx] + newKey + record[keyIdx+len(oldKey):]
+}
+
+// applyLintFixes returns content with the fixes of issues applied. Renames
+// happen on the key's own line, other assignments of the old key are
+// dropped. Encrypted values of renamed keys still have to be sealed again
+// under the new name (see resealRenamed).
+func applyLintFixes(content string, format string, issues []LintIssue) string {
+	records := splitRecords(content, format)
+	entries := lintEntries(content, format)
+	deleted := make(map[int]bool)
+	fixCRLF := false
+	for _, issue := range issues {
+		if issue.Fix == "" {
+			continue
+		}
+		idx := issue.Line - 1
+		switch issue.Kind {
+		case LintCRLF:
+			fixCRLF = true
+		case LintDuplicate:
+			for line := idx; line < issue.EndLine; line++ {
+				deleted[line] = true
+			}
+		case LintInvalidKey:
+			if idx < 0 || idx >= len(records) || issue.NewKey == "" {
+				continue
+			}
+			records[idx] = renameRecord(records[idx], issue.Key, issue.NewKey)
+			for _, entry := range entries {
+				if entry.Key == issue.Key && entry.StartLine != idx {
+					for line := entry.StartLine; line <= entry.EndLine; line++ {
+						deleted[line] = true
+					}
+				}
+			}
+		case LintTrailing, LintUnterminated:
+			if idx < 0 || idx >= len(records) {
+				continue
+			}
+			body, hadCR := strings.CutSuffix(records[idx], "\r")
+			body = strings.TrimRight(body, " \t")
+			if issue.Kind == LintUnterminated {
+				body += issue.Quote
+			}
+			if hadCR {
+				body += "\r"
+			}
+			records[idx] = body
+		}
+	}
+	var out []string
+	for idx, record := range records {
+		if deleted[idx] {
+			continue
+		}
+		if fixCRLF {
+			record = strings.TrimSuffix(record, "\r")
+		}
+		out = append(out, record)
+	}
+	return joinRecords(out, format)
+}
+
+// lintRenames returns the key renames (old -> new) of the fixable issues
+func lintRenames(issues []LintIssue) map[string]string {
+	rtn := make(map[string]string)
+	for _, issue := range issues {
+		if issue.Kind == LintInvalidKey && issue.NewKey != "" {
+			rtn[issue.Key] = issue.NewKey
+		}
+	}
+	return rtn
+}
+
+// fixAllLint applies every quick fix, re-linting between passes. Renames
+// go last, once the lines are final.
+func fixAllLint(content string, format string) (string, map[string]string) {
+	for pass := 0; pass < maxFixPasses; pass++ {
+		var textFixes []LintIssue
+		for _, issue := range lintEnv(content, format) {
+			if issue.Fix != "" && issue.Kind != LintInvalidKey {
+				textFixes = append(textFixes, issue)
+			}
+		}
+		if len(textFixes) == 0 {
+			break
+		}
+		content = applyLintFixes(content, format, textFixes)
+	}
+	var renames []LintIssue
+	for _, issue := range lintEnv(content, format) {
+		if issue.Kind == LintInvalidKey && issue.NewKey != "" {
+			renames = append(renames, issue)
+		}
+	}
+	return applyLintFixes(content, format, renames), lintRenames(renames)
+}
+
+// resealRenamed seals the encrypted values of renamed keys (old -> new)
+// again under their new name, envelopes are bound to the key name. The
+// envelope text is replaced in place so the layout of content is kept.
+func resealRenamed(content string, format string, renames map[string]string) (string, error) {
+	stored := parseEnv(content, format)
+	for oldKey, newKey := range renames {
+		val := stored[newKey]
+		if !isEncryptedValue(val) {
+			continue
+		}
+		key, err := loadKey()
+		if err != nil {
+			return "", err
+		}
+		plain, err := decryptValue(key, oldKey, val)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", oldKey, err)
+		}
+		sealed, err := encryptValue(key, newKey, plain)
+		if err != nil {
+			return "", fmt.Errorf("encrypting %s: %w", newKey, err)
+		}
+		content = strings.Replace(content, val, sealed, 1)
+	}
+	return content, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// lintKinds returns "kind:line" for each issue
+func lintKinds(issues []LintIssue) []string {
+	var rtn []string
+	for _, issue := range issues {
+		rtn = append(rtn, fmt.Sprintf("%s:%d", issue.Kind, issue.Line))
+	}
+	return rtn
+}
+
+func TestLintEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		want    []string
+	}{
+		{"clean", "A=1\nB=\"x\ny\"\n", FormatDotenv, nil},
+		{"duplicate", "A=1\nB=2\nA=3\n", FormatDotenv, []string{"duplicate:1"}},
+		{"invalid key", "MY-KEY=1\n", FormatDotenv, []string{"invalid-key:1"}},
+		{"trailing", "A=1  \n", FormatDotenv, []string{"trailing-space:1"}},
+		{"trailing inside a value", "A=\"x  \ny\"\n", FormatDotenv, nil},
+		{"crlf", "A=1\r\nB=2\r\n", FormatDotenv, []string{"crlf:0"}},
+		{"unterminated", "A=\"x\nB=2\n", FormatDotenv, []string{"unterminated:1"}},
+		{"nul duplicate", "A=1\x00A=2\x00", FormatNul, []string{"duplicate:1"}},
+		{"nul trailing", "A=1 \x00", FormatNul, []string{"trailing-space:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lintKinds(lintEnv(tt.content, tt.format)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintNulTrailingHasNoFix(t *testing.T) {
+	issues := lintEnv("A=1 \x00", FormatNul)
+	if len(issues) != 1 || issues[0].Fix != "" {
+		t.Fatalf("got %+v, want one issue without a fix", issues)
+	}
+	if got := applyLintFixes("A=1 \x00", FormatNul, issues); got != "A=1 \x00" {
+		t.Errorf("value changed to %q", got)
+	}
+}
+
+func TestApplyLintFixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		kind    string
+		want    string
+	}{
+		{"duplicate", "# c\nA=1\nB=2\nA=3\n", FormatDotenv, LintDuplicate, "# c\nB=2\nA=3\n"},
+		{"multi-line duplicate", "A=\"x\ny\"\nA=3\n", FormatDotenv, LintDuplicate, "A=3\n"},
+		{"invalid key", "export MY-KEY=1 # c\n", FormatDotenv, LintInvalidKey, "export MY_KEY=1 # c\n"},
+		{"trailing", "A=1 \t\nB=2\n", FormatDotenv, LintTrailing, "A=1\nB=2\n"},
+		{"crlf", "A=1\r\nB=\"x\r\ny\"\r\n", FormatDotenv, LintCRLF, "A=1\nB=\"x\ny\"\n"},
+		{"unterminated", "A='x\nB=2\n", FormatDotenv, LintUnterminated, "A='x'\nB=2\n"},
+		{"nul duplicate", "A=1\x00B=2\x00A=3\x00", FormatNul, LintDuplicate, "B=2\x00A=3\x00"},
+		{"nul invalid key", "MY.KEY=1\x00", FormatNul, LintInvalidKey, "MY_KEY=1\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var issues []LintIssue
+			for _, issue := range lintEnv(tt.content, tt.format) {
+				if issue.Kind == tt.kind {
+					issues = append(issues, issue)
+				}
+			}
+			if len(issues) == 0 {
+				t.Fatalf("no %s issue found", tt.kind)
+			}
+			if got := applyLintFixes(tt.content, tt.format, issues); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixAllLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		want    string
+		renames map[string]string
+	}{
+		{
+			name:    "every kind",
+			content: "# keep\r\nMY-KEY=1 \r\nA=1\r\nA=2\r\nB='open\r\n",
+			format:  FormatDotenv,
+			want:    "# keep\nMY_KEY=1\nA=2\nB='open'\n",
+			renames: map[string]string{"MY-KEY": "MY_KEY"},
+		},
+		{
+			name:    "duplicate invalid key",
+			content: "MY-KEY=1\nMY-KEY=2\n",
+			format:  FormatDotenv,
+			want:    "MY_KEY=2\n",
+			renames: map[string]string{"MY-KEY": "MY_KEY"},
+		},
+		{
+			name:    "rename target taken",
+			content: "MY-KEY=1\nMY_KEY=2\n",
+			format:  FormatDotenv,
+			want:    "MY-KEY=1\nMY_KEY=2\n",
+			renames: map[string]string{},
+		},
+		{
+			name:    "unterminated quote swallowing lines",
+			content: "A=\"x\nB=2  \n",
+			format:  FormatDotenv,
+			want:    "A=\"x\"\nB=2\n",
+			renames: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, renames := fixAllLint(tt.content, tt.format)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(renames, tt.renames) {
+				t.Errorf("renames: got %v, want %v", renames, tt.renames)
+			}
+			for _, issue := range lintEnv(got, tt.format) {
+				if issue.Fix != "" {
+					t.Errorf("fixable issue left: %+v", issue)
+				}
+			}
+		})
+	}
+}
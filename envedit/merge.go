@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	MergeChoiceMine   = "mine"
+	MergeChoiceTheirs = "theirs"
+)
+
+// MergeValue is one side of a merge, Present is false when the key is absent
+type MergeValue struct {
+	Value   string `json:"value"`
+	Present bool   `json:"present"`
+}
+
+type MergeConflict struct {
+	Key    string     `json:"key"`
+	Base   MergeValue `json:"base"`
+	Mine   MergeValue `json:"mine"`
+	Theirs MergeValue `json:"theirs"`
+	Choice string     `json:"choice"`
+}
+
+// MergeState holds an in-progress merge of our edits with a newer file on disk
+type MergeState struct {
+	Merged    map[string]string `json:"merged"`
+	Conflicts []MergeConflict   `json:"conflicts"`
+	Disk      *EnvSnapshot      `json:"-"`
+}
+
+func lookupValue(m map[string]string, key string) MergeValue {
+	val, ok := m[key]
+	return MergeValue{Value: val, Present: ok}
+}
+
+// mergeEnv does a key-level three-way merge. Keys changed on only one side
+// take that side's value, keys changed identically on both sides are kept,
+// and keys changed differently on both sides are returned as conflicts
+// (defaulting to our value in merged).
+func mergeEnv(base, mine, theirs map[string]string) (map[string]string, []MergeConflict) {
+	keySet := make(map[string]bool)
+	for _, m := range []map[string]string{base, mine, theirs} {
+		for k := range m {
+			keySet[k] = true
+		}
+	}
+	var keys []string
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	merged := make(map[string]string)
+	var conflicts []MergeConflict
+	for _, key := range keys {
+		b := lookupValue(base, key)
+		m := lookupValue(mine, key)
+		t := lookupValue(theirs, key)
+		result := m
+		switch {
+		case m == b:
+			result = t
+		case t == b, m == t:
+			result = m
+		default:
+			conflicts = append(conflicts, MergeConflict{
+				Key:    key,
+				Base:   b,
+				Mine:   m,
+				Theirs: t,
+				Choice: MergeChoiceMine,
+			})
+		}
+		if result.Present {
+			merged[key] = result.Value
+		}
+	}
+	return merged, conflicts
+}
+
+// resolve applies the chosen side of each conflict on top of the clean merge
+func (ms *MergeState) resolve() map[string]string {
+	rtn := make(map[string]string)
+	for k, v := range ms.Merged {
+		rtn[k] = v
+	}
+	for _, c := range ms.Conflicts {
+		val := c.Mine
+		if c.Choice == MergeChoiceTheirs {
+			val = c.Theirs
+		}
+		if val.Present {
+			rtn[c.Key] = val.Value
+		} else {
+			delete(rtn, c.Key)
+		}
+	}
+	return rtn
+}
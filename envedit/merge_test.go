@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      map[string]string
+		mine      map[string]string
+		theirs    map[string]string
+		merged    map[string]string
+		conflicts []string
+	}{
+		{
+			name:   "unchanged",
+			base:   map[string]string{"A": "1"},
+			mine:   map[string]string{"A": "1"},
+			theirs: map[string]string{"A": "1"},
+			merged: map[string]string{"A": "1"},
+		},
+		{
+			name:   "changed by us",
+			base:   map[string]string{"A": "1", "B": "2"},
+			mine:   map[string]string{"A": "x", "B": "2"},
+			theirs: map[string]string{"A": "1", "B": "2"},
+			merged: map[string]string{"A": "x", "B": "2"},
+		},
+		{
+			name:   "changed by them",
+			base:   map[string]string{"A": "1"},
+			mine:   map[string]string{"A": "1"},
+			theirs: map[string]string{"A": "y"},
+			merged: map[string]string{"A": "y"},
+		},
+		{
+			name:   "different keys on both sides",
+			base:   map[string]string{"A": "1", "B": "2"},
+			mine:   map[string]string{"A": "x", "B": "2"},
+			theirs: map[string]string{"A": "1", "B": "y"},
+			merged: map[string]string{"A": "x", "B": "y"},
+		},
+		{
+			name:   "same change on both sides",
+			base:   map[string]string{"A": "1"},
+			mine:   map[string]string{"A": "2"},
+			theirs: map[string]string{"A": "2"},
+			merged: map[string]string{"A": "2"},
+		},
+		{
+			name:   "added on both sides",
+			base:   map[string]string{},
+			mine:   map[string]string{"A": "1"},
+			theirs: map[string]string{"B": "2"},
+			merged: map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name:   "deleted by them",
+			base:   map[string]string{"A": "1", "B": "2"},
+			mine:   map[string]string{"A": "1", "B": "2"},
+			theirs: map[string]string{"A": "1"},
+			merged: map[string]string{"A": "1"},
+		},
+		{
+			name:      "changed differently",
+			base:      map[string]string{"A": "1"},
+			mine:      map[string]string{"A": "2"},
+			theirs:    map[string]string{"A": "3"},
+			merged:    map[string]string{"A": "2"},
+			conflicts: []string{"A"},
+		},
+		{
+			name:      "deleted by us, changed by them",
+			base:      map[string]string{"A": "1"},
+			mine:      map[string]string{},
+			theirs:    map[string]string{"A": "3"},
+			merged:    map[string]string{},
+			conflicts: []string{"A"},
+		},
+		{
+			name:      "added differently",
+			base:      map[string]string{},
+			mine:      map[string]string{"A": "1", "B": "2"},
+			theirs:    map[string]string{"A": "9", "B": "2"},
+			merged:    map[string]string{"A": "1", "B": "2"},
+			conflicts: []string{"A"},
+		},
+		{
+			name:   "empty value is present",
+			base:   map[string]string{"A": "1"},
+			mine:   map[string]string{"A": ""},
+			theirs: map[string]string{"A": "1"},
+			merged: map[string]string{"A": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := mergeEnv(tt.base, tt.mine, tt.theirs)
+			if !reflect.DeepEqual(merged, tt.merged) {
+				t.Errorf("merged: got %v, want %v", merged, tt.merged)
+			}
+			var keys []string
+			for _, c := range conflicts {
+				keys = append(keys, c.Key)
+				if c.Choice != MergeChoiceMine {
+					t.Errorf("conflict %s: default choice %q, want %q", c.Key, c.Choice, MergeChoiceMine)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.conflicts) {
+				t.Errorf("conflicts: got %v, want %v", keys, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeResolve(t *testing.T) {
+	merged, conflicts := mergeEnv(
+		map[string]string{"A": "1", "B": "1", "C": "1"},
+		map[string]string{"A": "2", "C": "2"},
+		map[string]string{"A": "3", "B": "3", "C": "1"},
+	)
+	ms := &MergeState{Merged: merged, Conflicts: conflicts}
+	for i := range ms.Conflicts {
+		if ms.Conflicts[i].Key == "A" {
+			ms.Conflicts[i].Choice = MergeChoiceTheirs
+		}
+	}
+	// A: theirs picked, B: deleted by us and kept deleted, C: ours
+	want := map[string]string{"A": "3", "C": "2"}
+	if got := ms.resolve(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeySchema describes one variable. It is filled from a JSON schema (a
+// subset of JSON Schema: type, format, pattern, enum, minimum, maximum,
+// default, description) and/or a .env.example file, where every listed key
+// is required and its value is used as the default.
+type KeySchema struct {
+	Type        string   `json:"type,omitempty"` // string, integer, number, boolean
+	Format      string   `json:"format,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+	Description string   `json:"description,omitempty"`
+	RawEnum     []any    `json:"enum,omitempty"`
+	RawDefault  any      `json:"default,omitempty"`
+
+	// env values are always strings, so enum and default are normalized
+	Enum     []string `json:"-"`
+	Default  *string  `json:"-"`
+	Required bool     `json:"-"`
+
+	patternRe *regexp.Regexp
+}
+
+type jsonSchemaFile struct {
+	Required   []string              `json:"required"`
+	Properties map[string]*KeySchema `json:"properties"`
+}
+
+type Schema struct {
+	Keys    map[string]*KeySchema
+	Sources []string
+}
+
+type ValidationResult struct {
+	Missing []string            `json:"missing"`
+	Unknown []string            `json:"unknown"`
+	Errors  map[string][]string `json:"errors"`
+}
+
+func (r *ValidationResult) IsValid() bool {
+	return len(r.Missing) == 0 && len(r.Errors) == 0
+}
+
+// errorsFor and isUnknown are nil safe, nil meaning there is no schema
+func (r *ValidationResult) errorsFor(key string) []string {
+	if r == nil {
+		return nil
+	}
+	return r.Errors[key]
+}
+
+func (r *ValidationResult) isUnknown(key string) bool {
+	if r == nil {
+		return false
+	}
+	idx := sort.SearchStrings(r.Unknown, key)
+	return idx < len(r.Unknown) && r.Unknown[idx] == key
+}
+
+func (s *Schema) key(name string) *KeySchema {
+	ks := s.Keys[name]
+	if ks == nil {
+		ks = &KeySchema{}
+		s.Keys[name] = ks
+	}
+	return ks
+}
+
+func (s *Schema) loadExample(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range parseDotenvEntries(string(content)) {
+		ks := s.key(entry.Key)
+		ks.Required = true
+		if ks.Default == nil && entry.Value != "" {
+			val := entry.Value
+			ks.Default = &val
+		}
+	}
+	s.Sources = append(s.Sources, path)
+	return nil
+}
+
+func (s *Schema) loadJSON(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file jsonSchemaFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("parsing schema %s: %w", path, err)
+	}
+	for name, ks := range file.Properties {
+		if ks == nil {
+			continue
+		}
+		for _, e := range ks.RawEnum {
+			ks.Enum = append(ks.Enum, fmt.Sprint(e))
+		}
+		if ks.RawDefault != nil {
+			def := fmt.Sprint(ks.RawDefault)
+			ks.Default = &def
+		}
+		if ks.Pattern != "" {
+			ks.patternRe, err = regexp.Compile(ks.Pattern)
+			if err != nil {
+				return fmt.Errorf("schema %s: invalid pattern for %s: %w", path, name, err)
+			}
+		}
+		if existing := s.Keys[name]; existing != nil {
+			ks.Required = existing.Required
+			if ks.Default == nil {
+				ks.Default = existing.Default
+			}
+		}
+		s.Keys[name] = ks
+	}
+	for _, name := range file.Required {
+		s.key(name).Required = true
+	}
+	s.Sources = append(s.Sources, path)
+	return nil
+}
+
+// loadSchema loads schemaPath (a .json schema or a .env.example style file)
+// and auto-discovers an example file next to envFile. Returns nil if no
+// schema source exists.
+func loadSchema(envFile string, schemaPath string) (*Schema, error) {
+	schema := &Schema{Keys: make(map[string]*KeySchema)}
+	if schemaPath != "" && strings.HasSuffix(schemaPath, ".json") {
+		if err := schema.loadJSON(schemaPath); err != nil {
+			return nil, err
+		}
+	} else if schemaPath != "" {
+		if err := schema.loadExample(schemaPath); err != nil {
+			return nil, err
+		}
+	}
+	if schemaPath == "" || strings.HasSuffix(schemaPath, ".json") {
+		candidates := []string{
+			envFile + ".example",
+			filepath.Join(filepath.Dir(envFile), ".env.example"),
+		}
+		for _, candidate := range candidates {
+			if _, err := os.Stat(candidate); err != nil || candidate == envFile {
+				continue
+			}
+			if err := schema.loadExample(candidate); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if len(schema.Sources) == 0 {
+		return nil, nil
+	}
+	return schema, nil
+}
+
+// validateValue returns the problems with val (empty if it is valid)
+func (ks *KeySchema) validateValue(val string) []string {
+	var rtn []string
+	var num float64
+	isNum := false
+	switch ks.Type {
+	case "integer":
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			rtn = append(rtn, "must be an integer")
+		} else {
+			num, isNum = float64(n), true
+		}
+	case "number":
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			rtn = append(rtn, "must be a number")
+		} else {
+			num, isNum = n, true
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(val); err != nil {
+			rtn = append(rtn, "must be a boolean (true/false/1/0)")
+		}
+	}
+	switch ks.Format {
+	case "uri", "url":
+		u, err := url.Parse(val)
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			rtn = append(rtn, "must be a URL with a scheme and host")
+		}
+	case "port":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > 65535 {
+			rtn = append(rtn, "must be a port number (1-65535)")
+		} else {
+			num, isNum = float64(n), true
+		}
+	}
+	if isNum && ks.Minimum != nil && num < *ks.Minimum {
+		rtn = append(rtn, fmt.Sprintf("must be >= %v", *ks.Minimum))
+	}
+	if isNum && ks.Maximum != nil && num > *ks.Maximum {
+		rtn = append(rtn, fmt.Sprintf("must be <= %v", *ks.Maximum))
+	}
+	if ks.patternRe != nil && !ks.patternRe.MatchString(val) {
+		rtn = append(rtn, fmt.Sprintf("must match /%s/", ks.Pattern))
+	}
+	if len(ks.Enum) > 0 {
+		found := false
+		for _, e := range ks.Enum {
+			if e == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rtn = append(rtn, "must be one of "+strings.Join(ks.Enum, ", "))
+		}
+	}
+	return rtn
+}
+
+func (s *Schema) Validate(envMap map[string]string) *ValidationResult {
+	rtn := &ValidationResult{Errors: make(map[string][]string)}
+	for name, ks := range s.Keys {
+		val, ok := envMap[name]
+		if !ok {
+			if ks.Required {
+				rtn.Missing = append(rtn.Missing, name)
+			}
+			continue
+		}
+		if errs := ks.validateValue(val); len(errs) > 0 {
+			rtn.Errors[name] = errs
+		}
+	}
+	for name := range envMap {
+		if _, ok := s.Keys[name]; !ok {
+			rtn.Unknown = append(rtn.Unknown, name)
+		}
+	}
+	sort.Strings(rtn.Missing)
+	sort.Strings(rtn.Unknown)
+	return rtn
+}
+
+// MissingDefaults returns the values to use when adding the missing keys
+func (s *Schema) MissingDefaults(missing []string) map[string]string {
+	rtn := make(map[string]string)
+	for _, name := range missing {
+		val := ""
+		if ks := s.Keys[name]; ks != nil && ks.Default != nil {
+			val = *ks.Default
+		}
+		rtn[name] = val
+	}
+	return rtn
+}
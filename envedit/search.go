@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+)
+
+// KeyGroup is a run of keys sharing a prefix such as "AWS_"
+type KeyGroup struct {
+	Prefix string   `json:"prefix"`
+	Keys   []string `json:"keys"`
+}
+
+func keyPrefix(key string) string {
+	idx := strings.IndexByte(key, '_')
+	if idx <= 0 {
+		return ""
+	}
+	return key[:idx+1]
+}
+
+// groupKeys groups sorted keys by the text up to the first "_". Prefixes
+// with a single key are not worth a group and go into the ungrouped
+// group (Prefix ""), which comes first.
+func groupKeys(keys []string) []KeyGroup {
+	counts := make(map[string]int)
+	for _, key := range keys {
+		counts[keyPrefix(key)]++
+	}
+	ungrouped := KeyGroup{}
+	var groups []KeyGroup
+	groupIdx := make(map[string]int)
+	for _, key := range keys {
+		prefix := keyPrefix(key)
+		if prefix == "" || counts[prefix] < 2 {
+			ungrouped.Keys = append(ungrouped.Keys, key)
+			continue
+		}
+		idx, ok := groupIdx[prefix]
+		if !ok {
+			idx = len(groups)
+			groupIdx[prefix] = idx
+			groups = append(groups, KeyGroup{Prefix: prefix})
+		}
+		groups[idx].Keys = append(groups[idx].Keys, key)
+	}
+	if len(ungrouped.Keys) == 0 {
+		return groups
+	}
+	return append([]KeyGroup{ungrouped}, groups...)
+}
+
+// matchesSearch does a case-insensitive substring match against the key and
+// its raw and expanded values
+func matchesSearch(query string, key string, values ...string) bool {
+	if query == "" {
+		return true
+	}
+	query = strings.ToLower(query)
+	if strings.Contains(strings.ToLower(key), query) {
+		return true
+	}
+	for _, val := range values {
+		if strings.Contains(strings.ToLower(val), query) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// niceNum rounds x to 1, 2, 5 or 10 times a power of ten (Heckbert's
+// "nice numbers for graph labels"), rounding to nearest or up
+func niceNum(x float64, round bool) float64 {
+	exp := math.Floor(math.Log10(x))
+	frac := x / math.Pow(10, exp)
+	var nice float64
+	switch {
+	case round && frac < 1.5:
+		nice = 1
+	case round && frac < 3:
+		nice = 2
+	case round && frac < 7:
+		nice = 5
+	case round:
+		nice = 10
+	case frac <= 1:
+		nice = 1
+	case frac <= 2:
+		nice = 2
+	case frac <= 5:
+		nice = 5
+	default:
+		nice = 10
+	}
+	return nice * math.Pow(10, exp)
+}
+
+// niceTicks widens lo..hi to multiples of a nice step giving about
+// maxTicks ticks, and returns the tick values
+func niceTicks(lo float64, hi float64, maxTicks int) (float64, float64, []float64) {
+	if hi <= lo {
+		// flat data, give it some room
+		delta := math.Max(math.Abs(lo)*0.1, 1)
+		lo, hi = lo-delta, hi+delta
+	}
+	span := niceNum(hi-lo, false)
+	step := niceNum(span/float64(maxTicks-1), true)
+	niceLo := math.Floor(lo/step) * step
+	niceHi := math.Ceil(hi/step) * step
+	var ticks []float64
+	for i := 0; niceLo+float64(i)*step <= niceHi+step/2; i++ {
+		tick := niceLo + float64(i)*step
+		if math.Abs(tick) < step/1e6 {
+			tick = 0 // no -0 from rounding
+		}
+		ticks = append(ticks, tick)
+	}
+	return niceLo, niceHi, ticks
+}
+
+// formatTickValue formats a y tick compactly so it fits the padding
+func formatTickValue(v float64) string {
+	abs := math.Abs(v)
+	suffix := ""
+	switch {
+	case abs >= 1e9:
+		v, suffix = v/1e9, "G"
+	case abs >= 1e6:
+		v, suffix = v/1e6, "M"
+	case abs >= 1e4:
+		v, suffix = v/1e3, "k"
+	}
+	rtn := strconv.FormatFloat(v, 'f', 3, 64)
+	rtn = strings.TrimRight(strings.TrimRight(rtn, "0"), ".")
+	if abs != 0 && abs < 1e-3 {
+		rtn = strconv.FormatFloat(v, 'g', 2, 64)
+	}
+	return rtn + suffix
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+)
+
+// lttb downsamples points to at most threshold points with the
+// Largest-Triangle-Three-Buckets algorithm (Steinarsson), which keeps the
+// visual shape (peaks and dips) of the series. The first and last point
+// are always kept.
+func lttb(points []DataPoint, threshold int) []DataPoint {
+	if threshold < 3 || len(points) <= threshold {
+		return points
+	}
+	rtn := make([]DataPoint, 0, threshold)
+	rtn = append(rtn, points[0])
+
+	// the points between the first and last are split into threshold-2 buckets
+	bucketSize := float64(len(points)-2) / float64(threshold-2)
+	prev := 0
+	for i := 0; i < threshold-2; i++ {
+		start := int(math.Floor(float64(i)*bucketSize)) + 1
+		end := int(math.Floor(float64(i+1)*bucketSize)) + 1
+
+		// average of the next bucket, the third corner of the triangle
+		nextStart, nextEnd := end, int(math.Floor(float64(i+2)*bucketSize))+1
+		nextEnd = min(nextEnd, len(points))
+		var avgT, avgV float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgT += p.T
+			avgV += p.Value
+		}
+		n := float64(nextEnd - nextStart)
+		avgT, avgV = avgT/n, avgV/n
+
+		// pick the point of this bucket with the largest triangle
+		a := points[prev]
+		maxArea := -1.0
+		pick := start
+		for j := start; j < end; j++ {
+			area := math.Abs((a.T-avgT)*(points[j].Value-a.Value) - (a.T-points[j].T)*(avgV-a.Value))
+			if area > maxArea {
+				maxArea = area
+				pick = j
+			}
+		}
+		rtn = append(rtn, points[pick])
+		prev = pick
+	}
+	return append(rtn, points[len(points)-1])
+}
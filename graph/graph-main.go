@@ -4,14 +4,17 @@ import (
 	"bufio"
 	"context"
 	_ "embed"
+	"flag"
 	"fmt"
 	"math"
 	"os"
-	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/vdom"
 	"github.com/wavetermdev/waveterm/pkg/waveapp"
+	"waveapps/canvas"
 )
 
 //go:embed style.css
@@ -23,34 +26,39 @@ var AppClient = waveapp.MakeClient(waveapp.AppOpts{
 })
 
 type DataPoint struct {
+	T     float64 // unix seconds, from the line or its arrival
 	Value float64
 }
 
+var (
+	timeFlag    = flag.String("time", TimeAuto, "x axis time: auto (leading RFC3339 timestamp or epoch within a day of now, else arrival), epoch or arrival. A first column headed time, ts or timestamp is always read as the time")
+	historyFlag = flag.Int("history", 10000, "points kept per series, older points are dropped in batches so up to a quarter more are shown")
+	maxFPS      = flag.Int("fps", 10, "maximum number of re-renders per second while data is coming in")
+)
+
 const (
 	canvasWidth  = 800
 	canvasHeight = 400
 	padding      = 40
 	pointRadius  = 3 // Made slightly smaller
+	plotWidth    = canvasWidth - 2*padding
+	maxMarkers   = 100 // point markers are only drawn for short series
 )
 
-func calculateStats(points []DataPoint) (count int, avg float64) {
-	count = len(points)
-	if count == 0 {
-		return count, 0
-	}
-
-	sum := 0.0
-	for _, p := range points {
-		sum += p.Value
-	}
-	return count, sum / float64(count)
-}
-
 var App = waveapp.DefineComponent(AppClient, "App",
 	func(ctx context.Context, _ any) any {
 		// State for our data points and update counter
-		points, _, setPointsFn := vdom.UseStateWithFn(ctx, []DataPoint{})
+		data, _, setDataFn := vdom.UseStateWithFn(ctx, GraphData{History: *historyFlag})
 		updateCount, _, setUpdateCountFn := vdom.UseStateWithFn(ctx, 0)
+		hidden, setHidden := vdom.UseState(ctx, map[string]bool{})
+
+		// Series shown on the canvas, the legend can hide some
+		var visible []string
+		for _, name := range data.Names {
+			if !hidden[name] {
+				visible = append(visible, name)
+			}
+		}
 
 		// Reference for the canvas
 		canvasRef := vdom.UseVDomRef(ctx)
@@ -66,177 +74,142 @@ var App = waveapp.DefineComponent(AppClient, "App",
 
 		// Function to draw the graph
 		drawGraph := func() {
-			if !canvasRef.HasCurrent || len(points) == 0 {
+			if !canvasRef.HasCurrent || data.Samples == 0 {
 				return
 			}
+			c := canvas.New()
 
 			// Clear canvas
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "clearRect",
-				Params: []any{0, 0, canvasWidth, canvasHeight},
-			})
-
-			// Find max value for scaling
-			maxVal := points[0].Value
-			for _, p := range points {
-				if p.Value > maxVal {
-					maxVal = p.Value
-				}
+			c.ClearRect(0, 0, canvasWidth, canvasHeight)
+
+			// Downsample to about a point per pixel, so the number of canvas
+			// ops does not grow with the history
+			shown := make(map[string][]DataPoint, len(visible))
+			for _, name := range visible {
+				shown[name] = lttb(data.Series[name].Points, plotWidth)
 			}
-			maxVal = maxVal * 1.05 // Add 5% buffer
 
-			// Calculate scales
-			xScale := float64(canvasWidth-2*padding) / math.Max(float64(len(points)-1), 1)
-			yScale := float64(canvasHeight-2*padding) / maxVal
+			// Find the value range of the visible series, widened to nice ticks.
+			// From the full series, so the axis does not move with the buckets.
+			minVal, maxVal := math.Inf(1), math.Inf(-1)
+			for _, name := range visible {
+				minVal = math.Min(minVal, data.Series[name].Min)
+				maxVal = math.Max(maxVal, data.Series[name].Max)
+			}
+			if math.IsInf(maxVal, -1) {
+				minVal, maxVal = 0, 1
+			}
+			minVal, maxVal, yTicks := niceTicks(minVal, maxVal, 8)
+
+			// Calculate scales, all series share the time axis
+			minT, maxT := data.MinT, data.MaxT
+			if maxT <= minT {
+				maxT = minT + 1
+			}
+			xScale := float64(canvasWidth-2*padding) / (maxT - minT)
+			yScale := float64(canvasHeight-2*padding) / (maxVal - minVal)
+			xPos := func(t float64) float64 {
+				return padding + (t-minT)*xScale
+			}
+			yPos := func(v float64) float64 {
+				return canvasHeight - padding - (v-minVal)*yScale
+			}
 
 			// Draw grid (new!)
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "strokeStyle",
-				Params: []any{"#333333"},
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "lineWidth",
-				Params: []any{1},
-			})
-
-			// Vertical grid lines
-			for i := 0; i < 10; i++ {
-				x := padding + (float64(i) * (canvasWidth - 2*padding) / 9)
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "beginPath",
-					Params: nil,
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "moveTo",
-					Params: []any{x, padding},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "lineTo",
-					Params: []any{x, canvasHeight - padding},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "stroke",
-					Params: nil,
-				})
+			c.StrokeStyle("#333333").LineWidth(1)
+
+			// Vertical grid lines at the time ticks
+			ticks := timeTicks(minT, maxT, 8)
+			for _, tick := range ticks {
+				x := xPos(tick.T)
+				c.Line(x, padding, x, canvasHeight-padding)
+			}
+
+			// Horizontal grid lines at the value ticks
+			for _, tick := range yTicks {
+				y := yPos(tick)
+				c.Line(padding, y, canvasWidth-padding, y)
 			}
 
-			// Horizontal grid lines
-			for i := 0; i < 10; i++ {
-				y := padding + (float64(i) * (canvasHeight - 2*padding) / 9)
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "beginPath",
-					Params: nil,
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "moveTo",
-					Params: []any{padding, y},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "lineTo",
-					Params: []any{canvasWidth - padding, y},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "stroke",
-					Params: nil,
-				})
+			// Time labels under the x axis
+			c.FillStyle("#888888").Font("11px monospace").TextAlign(canvas.AlignCenter)
+			for _, tick := range ticks {
+				c.FillText(tick.Label, xPos(tick.T), canvasHeight-padding+16)
+			}
+
+			// Value labels left of the y axis
+			c.TextAlign(canvas.AlignRight).TextBaseline(canvas.BaselineMiddle)
+			for _, tick := range yTicks {
+				c.FillText(formatTickValue(tick), padding-6, yPos(tick))
+			}
+			c.TextBaseline(canvas.BaselineAlphabetic)
+
+			// Shade the gaps, where a series went much longer than usual
+			// without a point. Found in the full series, a downsampled point
+			// stands for a whole bucket and would hide or invent gaps.
+			c.FillStyle("rgba(255, 255, 255, 0.06)")
+			for _, name := range visible {
+				for _, gap := range data.Series[name].Gaps {
+					x := xPos(gap.Start)
+					c.FillRect(x, padding, xPos(gap.End)-x, canvasHeight-2*padding)
+				}
 			}
 
 			// Draw axes
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "beginPath",
-				Params: nil,
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "strokeStyle",
-				Params: []any{"#666666"},
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "lineWidth",
-				Params: []any{2},
-			})
+			c.BeginPath().StrokeStyle("#666666").LineWidth(2)
 
 			// Y axis
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "moveTo",
-				Params: []any{padding, padding},
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "lineTo",
-				Params: []any{padding, canvasHeight - padding},
-			})
+			c.MoveTo(padding, padding).LineTo(padding, canvasHeight-padding)
 
 			// X axis
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "moveTo",
-				Params: []any{padding, canvasHeight - padding},
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "lineTo",
-				Params: []any{canvasWidth - padding, canvasHeight - padding},
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "stroke",
-				Params: nil,
-			})
-
-			// Draw data line
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "beginPath",
-				Params: nil,
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "strokeStyle",
-				Params: []any{"#4488ff"},
-			})
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "lineWidth",
-				Params: []any{2},
-			})
-
-			// Draw lines connecting points
-			for i := 0; i < len(points); i++ {
-				x := padding + (float64(i) * xScale)
-				y := canvasHeight - padding - (points[i].Value * yScale)
-
-				if i == 0 {
-					vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-						Op:     "moveTo",
-						Params: []any{x, y},
-					})
-				} else {
-					vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-						Op:     "lineTo",
-						Params: []any{x, y},
-					})
-				}
+			c.MoveTo(padding, canvasHeight-padding).LineTo(canvasWidth-padding, canvasHeight-padding)
+			c.Stroke()
+
+			// Zero line when the values cross zero
+			if minVal < 0 && maxVal > 0 {
+				c.StrokeStyle("#999999").LineWidth(1)
+				c.Line(padding, yPos(0), canvasWidth-padding, yPos(0))
 			}
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "stroke",
-				Params: nil,
-			})
-
-			// Draw points
-			for i := 0; i < len(points); i++ {
-				x := padding + (float64(i) * xScale)
-				y := canvasHeight - padding - (points[i].Value * yScale)
-
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "beginPath",
-					Params: nil,
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "fillStyle",
-					Params: []any{"#4488ff"},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "arc",
-					Params: []any{x, y, pointRadius, 0, 2 * math.Pi},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "fill",
-					Params: nil,
-				})
+
+			for _, name := range visible {
+				points := shown[name]
+				color := data.Color(name)
+
+				// Draw data line
+				c.BeginPath().StrokeStyle(color).LineWidth(2)
+
+				// Draw lines connecting points, not across gaps. Gaps lie
+				// between two points of the full series, so one that ends by
+				// this point and started after the previous one is in between.
+				seriesGaps := data.Series[name].Gaps
+				for i := 0; i < len(points); i++ {
+					x := xPos(points[i].T)
+					y := yPos(points[i].Value)
+
+					broken := false
+					for len(seriesGaps) > 0 && seriesGaps[0].End <= points[i].T {
+						broken = broken || (i > 0 && seriesGaps[0].Start >= points[i-1].T)
+						seriesGaps = seriesGaps[1:]
+					}
+					if i == 0 || broken {
+						c.MoveTo(x, y)
+					} else {
+						c.LineTo(x, y)
+					}
+				}
+				c.Stroke()
+
+				// Draw points
+				if len(data.Series[name].Points) > maxMarkers {
+					continue
+				}
+				c.FillStyle(color)
+				for i := 0; i < len(points); i++ {
+					c.Circle(xPos(points[i].T), yPos(points[i].Value), pointRadius)
+				}
 			}
+
+			c.Flush(ctx, canvasRef)
 		}
 
 		// Effect to start reading data
@@ -246,19 +219,40 @@ var App = waveapp.DefineComponent(AppClient, "App",
 			}
 
 			readerState.Current.active = true
+			done := readerState.Current.done
+			// the reader only marks new data, the publisher re-renders at
+			// most *maxFPS times per second
+			var pending atomic.Bool
 			go func() {
 				scanner := bufio.NewScanner(os.Stdin)
 
 				for scanner.Scan() {
 					select {
-					case <-readerState.Current.done:
+					case <-done:
 						return
 					default:
 						text := strings.TrimSpace(scanner.Text())
-						if value, err := strconv.ParseFloat(text, 64); err == nil {
-							setPointsFn(func(points []DataPoint) []DataPoint {
-								return append(points, DataPoint{Value: value})
-							})
+						arrival := float64(time.Now().UnixNano()) / 1e9
+						added := false
+						setDataFn(func(data GraphData) GraphData {
+							data, added = data.addLine(text, arrival, *timeFlag)
+							return data
+						})
+						if added {
+							pending.Store(true)
+						}
+					}
+				}
+			}()
+			go func() {
+				ticker := time.NewTicker(time.Second / time.Duration(*maxFPS))
+				defer ticker.Stop()
+				for {
+					select {
+					case <-done:
+						return
+					case <-ticker.C:
+						if pending.Swap(false) {
 							setUpdateCountFn(func(updateCount int) int {
 								return updateCount + 1
 							})
@@ -279,10 +273,16 @@ var App = waveapp.DefineComponent(AppClient, "App",
 		vdom.UseEffect(ctx, func() func() {
 			drawGraph()
 			return nil
-		}, []any{updateCount, canvasRef.HasCurrent})
+		}, []any{updateCount, canvasRef.HasCurrent, strings.Join(visible, "\x00")})
 
-		// Calculate stats
-		count, avg := calculateStats(points)
+		toggleSeries := func(name string) {
+			newHidden := make(map[string]bool)
+			for k, v := range hidden {
+				newHidden[k] = v
+			}
+			newHidden[name] = !hidden[name]
+			setHidden(newHidden)
+		}
 
 		return vdom.E("div",
 			vdom.Class("graph-container"),
@@ -296,14 +296,59 @@ var App = waveapp.DefineComponent(AppClient, "App",
 				vdom.P("width", canvasWidth),
 				vdom.P("height", canvasHeight),
 			),
+			vdom.E("div",
+				vdom.Class("graph-legend"),
+				vdom.ForEach(data.Names, func(name string) any {
+					s := data.Series[name]
+					return vdom.E("div",
+						vdom.P("key", name),
+						vdom.Class("graph-legend-item"),
+						vdom.ClassIf(hidden[name], "hidden"),
+						vdom.P("title", "Show or hide "+name),
+						vdom.P("onClick", func() { toggleSeries(name) }),
+						vdom.E("span",
+							vdom.Class("graph-legend-swatch"),
+							vdom.PStyle("background", data.Color(name)),
+						),
+						name,
+						vdom.E("span",
+							vdom.Class("graph-legend-stats"),
+							fmt.Sprintf("%d pts, avg %.2f", len(s.Points), s.Mean()),
+						),
+					)
+				}),
+			),
 			vdom.E("div",
 				vdom.Class("graph-stats"),
-				fmt.Sprintf("Points: %d   Average: %.2f", count, avg),
+				fmt.Sprintf("Lines: %d   Series: %d   Span: %s", data.Samples, len(data.Names), time.Duration((data.MaxT-data.MinT)*1e9).Round(time.Millisecond)),
+				vdom.If(data.NonFinite > 0, fmt.Sprintf("   NaN/Inf: %d (not plotted)", data.NonFinite)),
+			),
+			vdom.If(data.BadTime > 0,
+				vdom.E("div",
+					vdom.Class("graph-warning"),
+					fmt.Sprintf("%d line(s) with an unreadable time column (RFC3339 or epoch seconds expected), placed at arrival", data.BadTime),
+				),
 			),
 		)
 	},
 )
 
 func main() {
+	AppClient.RegisterDefaultFlags()
+	flag.Parse()
+
+	if *historyFlag < 2 {
+		fmt.Fprintf(os.Stderr, "-history must be at least 2\n")
+		os.Exit(1)
+	}
+	if *maxFPS < 1 {
+		fmt.Fprintf(os.Stderr, "-fps must be at least 1\n")
+		os.Exit(1)
+	}
+	if *timeFlag != TimeAuto && *timeFlag != TimeEpoch && *timeFlag != TimeArrival {
+		fmt.Fprintf(os.Stderr, "-time must be auto, epoch or arrival\n")
+		os.Exit(1)
+	}
+
 	AppClient.RunMain()
 }
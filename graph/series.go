@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// seriesColors are assigned to series in order of appearance
+var seriesColors = []string{"#4488ff", "#ff6b6b", "#51cf66", "#fcc419", "#cc5de8", "#22b8cf", "#ff922b", "#adb5bd"}
+
+// NamedValue is one value of an input line
+type NamedValue struct {
+	Name  string
+	Value float64
+}
+
+// SeriesData holds the points of a series in time order, with the stats
+// and gaps a redraw needs. These are kept up to date as points come in, so
+// a redraw does not walk the history for them.
+type SeriesData struct {
+	Points []DataPoint
+	Sum    float64
+	Min    float64
+	Max    float64
+	Gaps   []Gap
+
+	gapThreshold float64
+	gapsAt       int // number of points when gapThreshold was computed, 0 before
+}
+
+func (s SeriesData) Mean() float64 {
+	if len(s.Points) == 0 {
+		return 0
+	}
+	return s.Sum / float64(len(s.Points))
+}
+
+// recount computes the stats from the points
+func (s *SeriesData) recount() {
+	s.Sum, s.Min, s.Max = 0, math.Inf(1), math.Inf(-1)
+	for _, p := range s.Points {
+		s.Sum += p.Value
+		s.Min = math.Min(s.Min, p.Value)
+		s.Max = math.Max(s.Max, p.Value)
+	}
+}
+
+// regap computes the gap threshold and the gaps from the points
+func (s *SeriesData) regap() {
+	s.gapThreshold = gapThreshold(s.Points)
+	s.Gaps = findGaps(s.Points, s.gapThreshold)
+	s.gapsAt = len(s.Points)
+}
+
+// add returns s with point added, s itself is not modified so a render in
+// progress can keep reading it. Beyond history points (if > 0) the oldest
+// are dropped in batches of a quarter of history, so the work of copying
+// the kept points and recomputing the stats is spread over the batch.
+func (s SeriesData) add(point DataPoint, history int) SeriesData {
+	if len(s.Points) == 0 {
+		s.Min, s.Max = point.Value, point.Value
+	}
+	s.Sum += point.Value
+	s.Min = math.Min(s.Min, point.Value)
+	s.Max = math.Max(s.Max, point.Value)
+	points := s.Points
+	last := len(points) - 1
+	switch {
+	case last >= 0 && point.T < points[last].T:
+		// out of order, insert it in time order so lines and gaps stay
+		// right. Clipped so the insert copies, the old slice may be in use.
+		idx := sort.Search(len(points), func(i int) bool { return points[i].T > point.T })
+		s.Points = slices.Insert(slices.Clip(points), idx, point)
+		s.regap()
+	default:
+		// appending is safe, a render only sees the points up to its length
+		s.Points = append(points, point)
+		if s.gapsAt > 0 && last >= 0 && point.T-points[last].T > s.gapThreshold {
+			s.Gaps = append(s.Gaps, Gap{Start: points[last].T, End: point.T})
+		}
+	}
+	if history > 0 && len(s.Points) > history+history/4 {
+		kept := make([]DataPoint, history, history+history/4+1)
+		copy(kept, s.Points[len(s.Points)-history:])
+		s.Points = kept
+		s.recount()
+		s.regap()
+	} else if len(s.Points) >= max(2*s.gapsAt, 3) {
+		// the typical interval is known better as the series grows
+		s.regap()
+	}
+	return s
+}
+
+// GraphData holds every series, Names keeps the order they first appeared
+// in (which also picks their color)
+type GraphData struct {
+	Names     []string
+	Series    map[string]SeriesData
+	Header    []string // column names from a header line
+	Samples   int      // lines with values so far
+	BadTime   int      // lines whose time column could not be read, placed at arrival
+	NonFinite int      // NaN and ±Inf values, dropped
+	MinT      float64  // time range of all points, unix seconds
+	MaxT      float64
+	History   int // points kept per series, see SeriesData.add
+}
+
+func (data GraphData) Color(name string) string {
+	for idx, n := range data.Names {
+		if n == name {
+			return seriesColors[idx%len(seriesColors)]
+		}
+	}
+	return seriesColors[0]
+}
+
+// splitLine splits on commas if there are any, otherwise on whitespace
+func splitLine(line string) []string {
+	var fields []string
+	if strings.Contains(line, ",") {
+		fields = strings.Split(line, ",")
+	} else {
+		fields = strings.Fields(line)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// parseLine reads the values of a line (after the timestamp, if any):
+//
+//	12.5                 one series
+//	12.5 40 3            (or 12.5,40,3) a series per column, named by the header
+//	cpu 12.5 mem 40      name value pairs
+//	cpu=12.5 mem=40      same
+//	cpu,mem              a header line naming the columns
+//
+// header is non-nil when the line is a header
+func parseLine(fields []string, columns []string) (values []NamedValue, header []string, ok bool) {
+	if len(fields) == 0 {
+		return nil, nil, false
+	}
+	allNumbers, noNumbers, allPairs := true, true, true
+	for _, field := range fields {
+		number := isNumber(field)
+		allNumbers = allNumbers && number
+		noNumbers = noNumbers && !number
+		allPairs = allPairs && strings.Contains(field, "=")
+	}
+	switch {
+	case allNumbers:
+		for idx, field := range fields {
+			value, _ := strconv.ParseFloat(field, 64)
+			values = append(values, NamedValue{Name: columnName(columns, idx), Value: value})
+		}
+		return values, nil, true
+	case allPairs:
+		for _, field := range fields {
+			name, text, _ := strings.Cut(field, "=")
+			value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return nil, nil, false
+			}
+			values = append(values, NamedValue{Name: strings.TrimSpace(name), Value: value})
+		}
+		return values, nil, true
+	case noNumbers:
+		return nil, fields, true
+	case len(fields)%2 == 0:
+		for i := 0; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil || isNumber(fields[i]) {
+				return nil, nil, false
+			}
+			values = append(values, NamedValue{Name: fields[i], Value: value})
+		}
+		return values, nil, true
+	}
+	return nil, nil, false
+}
+
+// columnName names positional values, from the header when there is one
+func columnName(columns []string, idx int) string {
+	if idx < len(columns) && columns[idx] != "" {
+		return columns[idx]
+	}
+	return fmt.Sprintf("s%d", idx+1)
+}
+
+// isTimeColumn reports whether a header column names the time
+func isTimeColumn(name string) bool {
+	switch strings.ToLower(name) {
+	case "time", "ts", "timestamp":
+		return true
+	}
+	return false
+}
+
+// isHeaderLine reports whether fields are all names, no numbers
+func isHeaderLine(fields []string) bool {
+	for _, field := range fields {
+		if isNumber(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// addLine returns data with the values of line added, data itself is not
+// modified so a render in progress can keep reading it. Points are placed
+// at the leading timestamp of the line, or at arrival (unix seconds), and
+// kept sorted by time. A first column the header names time, ts or
+// timestamp is always the time (RFC3339 or any epoch), never a series.
+func (data GraphData) addLine(line string, arrival float64, timeMode string) (GraphData, bool) {
+	fields := splitLine(line)
+	columns := data.Header
+	t := arrival
+	badTime := false
+	switch {
+	case len(fields) >= 2 && len(columns) > 0 && isTimeColumn(columns[0]) && !isHeaderLine(fields):
+		ts, ok := parseTimestamp(fields[0], TimeEpoch, arrival)
+		if ok && timeMode != TimeArrival {
+			t = ts
+		}
+		badTime = !ok
+		fields, columns = fields[1:], columns[1:]
+	case len(fields) >= 2 && timeMode != TimeArrival:
+		if ts, ok := parseTimestamp(fields[0], timeMode, arrival); ok {
+			t = ts
+			fields = fields[1:]
+			if len(columns) == len(fields)+1 {
+				// header like "t,cpu,mem"
+				columns = columns[1:]
+			}
+		}
+	}
+	values, header, ok := parseLine(fields, columns)
+	if !ok {
+		return data, false
+	}
+	if header != nil {
+		data.Header = header
+		return data, true
+	}
+	if badTime {
+		data.BadTime++
+	}
+	// NaN and ±Inf cannot be placed on the axis, and would poison the
+	// range and the downsampling
+	var finite []NamedValue
+	for _, nv := range values {
+		if math.IsNaN(nv.Value) || math.IsInf(nv.Value, 0) {
+			data.NonFinite++
+			continue
+		}
+		finite = append(finite, nv)
+	}
+	values = finite
+	if len(values) == 0 {
+		return data, true
+	}
+	series := make(map[string]SeriesData, len(data.Series)+len(values))
+	for name, s := range data.Series {
+		series[name] = s
+	}
+	for _, nv := range values {
+		if _, ok := series[nv.Name]; !ok {
+			data.Names = append(data.Names[:len(data.Names):len(data.Names)], nv.Name)
+		}
+		series[nv.Name] = series[nv.Name].add(DataPoint{T: t, Value: nv.Value}, data.History)
+	}
+	data.Series = series
+	if data.Samples == 0 || t > data.MaxT {
+		data.MaxT = t
+	}
+	data.MinT = t
+	for _, s := range series {
+		data.MinT = math.Min(data.MinT, s.Points[0].T)
+	}
+	data.Samples++
+	return data, true
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// addLines feeds lines one second apart, starting at arrival
+func addLines(data GraphData, arrival float64, timeMode string, lines ...string) GraphData {
+	for idx, line := range lines {
+		data, _ = data.addLine(line, arrival+float64(idx), timeMode)
+	}
+	return data
+}
+
+func TestTimeColumn(t *testing.T) {
+	const arrival = 1.7e9
+	for _, header := range []string{"time,cpu,mem", "TS,cpu,mem", "Timestamp cpu mem"} {
+		for _, mode := range []string{TimeAuto, TimeEpoch} {
+			// epochs far from the arrival time are still the time column
+			data := addLines(GraphData{}, arrival, mode, header, "1000,1,2", "1010 3 4", "1970-01-01T00:20:00Z,5,6")
+			if !reflect.DeepEqual(data.Names, []string{"cpu", "mem"}) {
+				t.Fatalf("%q %s: series %v, want [cpu mem]", header, mode, data.Names)
+			}
+			var ts []float64
+			for _, p := range data.Series["cpu"].Points {
+				ts = append(ts, p.T)
+			}
+			if want := []float64{1000, 1010, 1200}; !reflect.DeepEqual(ts, want) {
+				t.Errorf("%q %s: times %v, want %v", header, mode, ts, want)
+			}
+			if data.BadTime != 0 {
+				t.Errorf("%q %s: %d bad times", header, mode, data.BadTime)
+			}
+		}
+	}
+}
+
+func TestBadTimeColumn(t *testing.T) {
+	const arrival = 1.7e9
+	data := addLines(GraphData{}, arrival, TimeAuto, "time,cpu", "12:00:01,5")
+	if !reflect.DeepEqual(data.Names, []string{"cpu"}) {
+		t.Fatalf("series %v, want [cpu]", data.Names)
+	}
+	if p := data.Series["cpu"].Points[0]; p.T != arrival+1 || p.Value != 5 {
+		t.Errorf("got %+v, want 5 at arrival", p)
+	}
+	if data.BadTime != 1 {
+		t.Errorf("got %d bad times, want 1", data.BadTime)
+	}
+}
+
+func TestTimeColumnArrival(t *testing.T) {
+	const arrival = 1.7e9
+	data := addLines(GraphData{}, arrival, TimeArrival, "time,cpu", "1000,5")
+	if p := data.Series["cpu"].Points; len(data.Names) != 1 || p[0].T != arrival+1 {
+		t.Errorf("got %v %v, want cpu at arrival", data.Names, p)
+	}
+}
+
+func TestAutoTime(t *testing.T) {
+	const arrival = 1.7e9
+	tests := []struct {
+		line  string
+		names []string
+		t     float64
+	}{
+		{"5", []string{"s1"}, arrival},
+		{"1500000000 5", []string{"s1", "s2"}, arrival},
+		{"1700000100 5", []string{"s1"}, 1700000100},
+		{"1700000100000 5", []string{"s1"}, 1700000100},
+		{"cpu=1 mem=2", []string{"cpu", "mem"}, arrival},
+	}
+	for _, tt := range tests {
+		data, ok := GraphData{}.addLine(tt.line, arrival, TimeAuto)
+		if !ok {
+			t.Fatalf("%q not added", tt.line)
+		}
+		if !reflect.DeepEqual(data.Names, tt.names) || data.MaxT != tt.t {
+			t.Errorf("%q: got %v at %v, want %v at %v", tt.line, data.Names, data.MaxT, tt.names, tt.t)
+		}
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	const arrival = 1.7e9
+	data := addLines(GraphData{}, arrival, TimeAuto, "1 NaN", "cpu=Inf mem=2", "NaN", "-inf,3", "5 6")
+	if data.NonFinite != 4 {
+		t.Errorf("got %d non-finite values, want 4", data.NonFinite)
+	}
+	for name, s := range data.Series {
+		for _, p := range s.Points {
+			if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+				t.Errorf("%s: non-finite point %+v", name, p)
+			}
+		}
+	}
+	if got := len(data.Series["s1"].Points); got != 2 {
+		t.Errorf("s1 has %d points, want 2", got)
+	}
+	// a non-finite time is not a time in epoch mode either
+	data, _ = GraphData{}.addLine("NaN 5", arrival, TimeEpoch)
+	if data.MaxT != arrival || data.NonFinite != 1 {
+		t.Errorf("got time %v with %d non-finite, want arrival and 1", data.MaxT, data.NonFinite)
+	}
+}
+
+func TestSeriesIncremental(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const history = 100
+	var s SeriesData
+	tm := 0.0
+	for i := 0; i < 1000; i++ {
+		tm += 1
+		if i%97 == 0 {
+			tm += 30 // a gap
+		}
+		pt := DataPoint{T: tm, Value: rng.NormFloat64()}
+		if i%50 == 0 {
+			pt.T -= 2.5 // out of order
+		}
+		s = s.add(pt, history)
+
+		if len(s.Points) < history && len(s.Points) != i+1 {
+			t.Fatalf("%d points after %d adds", len(s.Points), i+1)
+		}
+		if len(s.Points) > history+history/4 {
+			t.Fatalf("%d points kept, history %d", len(s.Points), history)
+		}
+		if !sort.SliceIsSorted(s.Points, func(a, b int) bool { return s.Points[a].T < s.Points[b].T }) {
+			t.Fatalf("points out of order after %d adds", i+1)
+		}
+		var want SeriesData
+		want.Points = s.Points
+		want.recount()
+		if math.Abs(s.Sum-want.Sum) > 1e-9 || s.Min != want.Min || s.Max != want.Max {
+			t.Fatalf("after %d adds: sum/min/max %v/%v/%v, want %v/%v/%v", i+1, s.Sum, s.Min, s.Max, want.Sum, want.Min, want.Max)
+		}
+		// no gaps until the typical interval is known
+		if s.gapsAt == 0 && len(s.Gaps) > 0 {
+			t.Fatalf("after %d adds: gaps %v before a threshold", i+1, s.Gaps)
+		}
+		if gaps := findGaps(s.Points, s.gapThreshold); s.gapsAt > 0 && !reflect.DeepEqual(s.Gaps, gaps) {
+			t.Fatalf("after %d adds: gaps %v, want %v", i+1, s.Gaps, gaps)
+		}
+	}
+	if len(s.Gaps) == 0 {
+		t.Error("no gaps found")
+	}
+}
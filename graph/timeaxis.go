@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	TimeAuto    = "auto"    // a leading RFC3339 timestamp or recent epoch, arrival time otherwise
+	TimeEpoch   = "epoch"   // the first field is always epoch seconds (or milliseconds)
+	TimeArrival = "arrival" // always stamp lines with the time they were read
+)
+
+// maxEpochSkew is how far from the arrival time a bare number may be to
+// count as an epoch in auto mode. Older or newer epochs need -time epoch.
+const maxEpochSkew = 24 * 3600
+
+// gapFactor is how many typical sampling intervals a series may go without
+// a point before the graph shows a gap
+const gapFactor = 5
+
+// parseTimestamp parses an RFC3339 time or epoch seconds/milliseconds.
+// In auto mode bare numbers only count as epochs within maxEpochSkew of
+// arrival (unix seconds), so plain values like 1500000000 bytes are not
+// mistaken for timestamps.
+func parseTimestamp(field string, mode string, arrival float64) (float64, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+		return float64(t.UnixNano()) / 1e9, true
+	}
+	num, err := strconv.ParseFloat(field, 64)
+	if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0, false
+	}
+	if mode == TimeEpoch {
+		if num >= 1e12 && num < 1e13 {
+			return num / 1e3, true
+		}
+		return num, true
+	}
+	for _, secs := range []float64{num, num / 1e3} {
+		if math.Abs(secs-arrival) <= maxEpochSkew {
+			return secs, true
+		}
+	}
+	return 0, false
+}
+
+// timeSteps are the tick intervals the axis picks from, in seconds
+var timeSteps = []float64{
+	0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5,
+	1, 2, 5, 10, 15, 30,
+	60, 2 * 60, 5 * 60, 10 * 60, 15 * 60, 30 * 60,
+	3600, 2 * 3600, 3 * 3600, 6 * 3600, 12 * 3600,
+	86400, 2 * 86400, 7 * 86400, 30 * 86400,
+}
+
+// TimeTick is a labeled position on the time axis
+type TimeTick struct {
+	T     float64
+	Label string
+}
+
+// timeTicks picks the smallest step that gives at most maxTicks ticks
+// between lo and hi (unix seconds) and labels them in local time
+func timeTicks(lo float64, hi float64, maxTicks int) []TimeTick {
+	span := hi - lo
+	if span <= 0 {
+		return []TimeTick{{T: lo, Label: formatTickTime(lo, 1)}}
+	}
+	step := timeSteps[len(timeSteps)-1]
+	for _, candidate := range timeSteps {
+		if span/candidate <= float64(maxTicks) {
+			step = candidate
+			break
+		}
+	}
+	// align to the step in local time, so minutes land on :00
+	_, offset := time.Unix(int64(lo), 0).Zone()
+	first := math.Ceil((lo+float64(offset))/step)*step - float64(offset)
+	var ticks []TimeTick
+	for i := 0; first+float64(i)*step <= hi; i++ {
+		t := first + float64(i)*step
+		ticks = append(ticks, TimeTick{T: t, Label: formatTickTime(t, step)})
+	}
+	return ticks
+}
+
+// formatTickTime shows as much of the time as the step needs
+func formatTickTime(t float64, step float64) string {
+	tm := time.Unix(0, int64(t*1e9))
+	switch {
+	case step < 1:
+		return tm.Format("15:04:05.000")
+	case step < 60:
+		return tm.Format("15:04:05")
+	case step < 86400:
+		return tm.Format("15:04")
+	}
+	return tm.Format("Jan 2")
+}
+
+// gapThreshold is the interval above which consecutive points of a series
+// are not connected, gapFactor times its median interval
+func gapThreshold(points []DataPoint) float64 {
+	if len(points) < 3 {
+		return math.Inf(1)
+	}
+	diffs := make([]float64, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		diffs = append(diffs, points[i].T-points[i-1].T)
+	}
+	sort.Float64s(diffs)
+	median := diffs[len(diffs)/2]
+	if median <= 0 {
+		return math.Inf(1)
+	}
+	return median * gapFactor
+}
+
+// Gap is a stretch of time in which a series has no points
+type Gap struct {
+	Start float64
+	End   float64
+}
+
+// findGaps returns the intervals between consecutive points that are
+// longer than threshold (see gapThreshold), in time order
+func findGaps(points []DataPoint, threshold float64) []Gap {
+	var rtn []Gap
+	for i := 1; i < len(points); i++ {
+		if points[i].T-points[i-1].T > threshold {
+			rtn = append(rtn, Gap{Start: points[i-1].T, End: points[i].T})
+		}
+	}
+	return rtn
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	RuleManual  = ""        // use NumBuckets
+	RuleFD      = "fd"      // Freedman–Diaconis
+	RuleSturges = "sturges" // Sturges
+)
+
+var ruleLabels = map[string]string{
+	RuleManual:  "Off",
+	RuleFD:      "Freedman-Diaconis",
+	RuleSturges: "Sturges",
+}
+
+const (
+	minBuckets = 2
+	maxBuckets = 100
+)
+
+// BucketOpts controls how the sketch is split into display buckets
+type BucketOpts struct {
+	NumBuckets int       `json:"numBuckets"`
+	Rule       string    `json:"rule"`
+	LogScale   bool      `json:"logScale"` // logarithmically spaced buckets
+	Edges      []float64 `json:"edges"`    // explicit boundaries, overrides everything else
+	MinValue   *float64  `json:"minValue"`
+	MaxValue   *float64  `json:"maxValue"`
+	Clip       bool      `json:"clip"` // leave out values outside MinValue..MaxValue (zoomed in)
+}
+
+type HistogramBucket struct {
+	Start  float64
+	End    float64
+	Count  int
+	Height int
+}
+
+// parseEdges parses an explicit, increasing boundary list like "1,5,10,50"
+// or "10ms,100ms,1s"
+func parseEdges(spec string) ([]float64, error) {
+	var rtn []float64
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		edge, _, ok := parseValue(part)
+		if !ok {
+			return nil, fmt.Errorf("invalid bucket boundary %q", part)
+		}
+		if len(rtn) > 0 && edge <= rtn[len(rtn)-1] {
+			return nil, fmt.Errorf("bucket boundaries must be increasing (%v after %v)", edge, rtn[len(rtn)-1])
+		}
+		rtn = append(rtn, edge)
+	}
+	if len(rtn) < 2 {
+		return nil, fmt.Errorf("need at least 2 bucket boundaries")
+	}
+	return rtn, nil
+}
+
+// autoBucketCount applies rule to the sketch, in log space for log buckets
+func autoBucketCount(sketch *Sketch, rule string, logScale bool, lo float64, hi float64) int {
+	n := float64(sketch.Count)
+	count := 0
+	switch rule {
+	case RuleSturges:
+		count = int(math.Ceil(math.Log2(n))) + 1
+	case RuleFD:
+		q1, q3 := sketch.Quantile(0.25), sketch.Quantile(0.75)
+		if logScale && q1 > 0 {
+			q1, q3, lo, hi = math.Log(q1), math.Log(q3), math.Log(lo), math.Log(hi)
+		}
+		width := 2 * (q3 - q1) / math.Cbrt(n)
+		if width <= 0 {
+			// no spread in the middle half, fall back to Sturges
+			return autoBucketCount(sketch, RuleSturges, logScale, lo, hi)
+		}
+		count = int(math.Ceil((hi - lo) / width))
+	}
+	return min(max(count, minBuckets), maxBuckets)
+}
+
+// bucketEdges returns the bucket boundaries and a warning if the options
+// could not be applied as asked
+func bucketEdges(sketch *Sketch, opts BucketOpts) ([]float64, string) {
+	if len(opts.Edges) >= 2 {
+		return opts.Edges, ""
+	}
+	lo, hi := sketch.Min, sketch.Max
+	if opts.MinValue != nil {
+		lo = *opts.MinValue
+	}
+	if opts.MaxValue != nil {
+		hi = *opts.MaxValue
+	}
+	warning := ""
+	logScale := opts.LogScale
+	if logScale && lo <= 0 {
+		logScale = false
+		warning = "log scale needs positive values, showing linear buckets"
+	}
+	if lo == hi {
+		// a single distinct value, more buckets would all be the same
+		return []float64{lo, hi}, warning
+	}
+	numBuckets := opts.NumBuckets
+	if opts.Rule != RuleManual {
+		numBuckets = autoBucketCount(sketch, opts.Rule, logScale, lo, hi)
+	}
+	edges := make([]float64, numBuckets+1)
+	for i := range edges {
+		frac := float64(i) / float64(numBuckets)
+		if logScale {
+			edges[i] = lo * math.Pow(hi/lo, frac)
+		} else {
+			edges[i] = lo + frac*(hi-lo)
+		}
+	}
+	return edges, warning
+}
+
+// makeBuckets splits the sketch into display buckets, values outside the
+// range land in the edge buckets unless opts.Clip is set
+func makeBuckets(sketch *Sketch, opts BucketOpts) ([]HistogramBucket, string) {
+	edges, warning := bucketEdges(sketch, opts)
+	buckets := make([]HistogramBucket, len(edges)-1)
+	for i, count := range sketch.BucketCounts(edges, opts.LogScale && warning == "", opts.Clip) {
+		buckets[i] = HistogramBucket{Start: edges[i], End: edges[i+1], Count: count}
+	}
+	return buckets, warning
+}
+
+// barFrac is the length of the bar of count relative to the longest bar
+// (0..1), on a log axis small counts stay visible next to a dominant bucket
+func barFrac(count int, maxCount int, logCounts bool) float64 {
+	if maxCount == 0 {
+		return 0
+	}
+	if logCounts {
+		return math.Log1p(float64(count)) / math.Log1p(float64(maxCount))
+	}
+	return float64(count) / float64(maxCount)
+}
+
+// scaleHeights sets the bar heights (0..maxHeight), on a log axis small
+// counts stay visible next to a dominant bucket
+func scaleHeights(buckets []HistogramBucket, maxHeight int, logCounts bool) {
+	maxCount := 0
+	for _, bucket := range buckets {
+		maxCount = max(maxCount, bucket.Count)
+	}
+	if maxCount == 0 {
+		return
+	}
+	for i := range buckets {
+		if logCounts {
+			buckets[i].Height = int(math.Round(barFrac(buckets[i].Count, maxCount, true) * float64(maxHeight)))
+		} else {
+			buckets[i].Height = (buckets[i].Count * maxHeight) / maxCount
+		}
+	}
+}
+
+// cumulative returns the fraction of all total values up to the end of
+// each bucket, below is the number of values before the first bucket
+func cumulative(counts []int, below float64, total int64) []float64 {
+	rtn := make([]float64, len(counts))
+	if total == 0 {
+		return rtn
+	}
+	sum := below
+	for i, count := range counts {
+		sum += float64(count)
+		rtn[i] = min(sum/float64(total), 1)
+	}
+	return rtn
+}
+
+// formatEdge formats a bucket boundary for the axis
+func formatEdge(v float64) string {
+	if v != 0 && math.Abs(v) < 1 {
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
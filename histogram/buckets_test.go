@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSingleValueBuckets(t *testing.T) {
+	s := MakeSketch()
+	for i := 0; i < 3; i++ {
+		s.Add(3)
+	}
+	for _, opts := range []BucketOpts{{NumBuckets: 10}, {Rule: RuleFD}, {NumBuckets: 10, LogScale: true}} {
+		buckets, _ := makeBuckets(s, opts)
+		if len(buckets) != 1 || buckets[0].Start != 3 || buckets[0].End != 3 || buckets[0].Count != 3 {
+			t.Errorf("%+v: got %+v, want one bucket 3-3 with 3 values", opts, buckets)
+		}
+	}
+}
+
+func TestTextBarsShowSmallBuckets(t *testing.T) {
+	s := MakeSketch()
+	for i := 0; i < 1000; i++ {
+		s.Add(float64(i % 10))
+	}
+	s.Add(1000)
+	var buf bytes.Buffer
+	renderText(&buf, s, nil, IngestStatus{}, BucketOpts{NumBuckets: 10}, false)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasSuffix(line, "│ 1") {
+			t.Errorf("bucket with one value has no bar: %q", line)
+		}
+	}
+	if !strings.Contains(buf.String(), "│▏ 1\n") {
+		t.Errorf("no bucket drawn with the smallest bar:\n%s", buf.String())
+	}
+}
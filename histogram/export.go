@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+)
+
+// ExportStats are the summary stats of all values or of one series, in
+// the base unit of the stream (seconds, bytes)
+type ExportStats struct {
+	Label       string             `json:"label,omitempty"`
+	Count       int64              `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Mean        float64            `json:"mean"`
+	Median      float64            `json:"median"`
+	StdDev      float64            `json:"stddev"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+type ExportBucket struct {
+	Start  float64        `json:"start"`
+	End    float64        `json:"end"`
+	Count  int            `json:"count"`
+	Series map[string]int `json:"series,omitempty"` // count per series when grouping
+}
+
+// ExportData is what -o and the export buttons write
+type ExportData struct {
+	Unit    string         `json:"unit"`
+	Window  string         `json:"window,omitempty"`
+	Buckets []ExportBucket `json:"buckets"`
+	Stats   ExportStats    `json:"stats"`
+	Series  []ExportStats  `json:"series,omitempty"`
+
+	// input that is not in the stats
+	Skipped   int64 `json:"skipped"`   // lines without a parseable value
+	Rejected  int64 `json:"rejected"`  // values in an incompatible unit
+	NonFinite int64 `json:"nonFinite"` // NaN and ±Inf values
+}
+
+// unitLabel names the base unit numbers are exported in
+func unitLabel(unit ValueUnit) string {
+	switch unit.Dim {
+	case DimDuration:
+		return "seconds"
+	case DimBytes:
+		return "bytes"
+	}
+	return ""
+}
+
+func makeExportStats(label string, sketch *Sketch) ExportStats {
+	stats := ExportStats{
+		Label:       label,
+		Count:       sketch.Count,
+		Min:         sketch.Min,
+		Max:         sketch.Max,
+		Mean:        sketch.Mean(),
+		Median:      sketch.Quantile(0.5),
+		StdDev:      sketch.StdDev(),
+		Percentiles: make(map[string]float64),
+	}
+	if sketch.Count == 0 {
+		// no infinities in json
+		stats.Min, stats.Max = 0, 0
+	}
+	for _, p := range percentiles {
+		stats.Percentiles[percentileLabel(p)] = sketch.Quantile(p / 100)
+	}
+	return stats
+}
+
+// makeExport buckets the sketch the same way the histogram does
+func makeExport(sketch *Sketch, series []Series, status IngestStatus, opts BucketOpts) ExportData {
+	rtn := ExportData{
+		Unit:      unitLabel(status.Unit),
+		Buckets:   []ExportBucket{},
+		Stats:     makeExportStats("", sketch),
+		Skipped:   status.Skipped,
+		Rejected:  status.Rejected,
+		NonFinite: status.NonFinite,
+	}
+	if windowSpec.IsSet() {
+		rtn.Window = windowSpec.Label()
+	}
+	if sketch.Count == 0 {
+		return rtn
+	}
+	buckets, warning := makeBuckets(sketch, opts)
+	counts := seriesCounts(series, buckets, opts.LogScale && warning == "", opts.Clip)
+	for idx, bucket := range buckets {
+		eb := ExportBucket{Start: bucket.Start, End: bucket.End, Count: bucket.Count}
+		if len(series) > 0 {
+			eb.Series = make(map[string]int)
+			for i, s := range series {
+				eb.Series[s.Label] = counts[i][idx]
+			}
+		}
+		rtn.Buckets = append(rtn.Buckets, eb)
+	}
+	for _, s := range series {
+		rtn.Series = append(rtn.Series, makeExportStats(s.Label, s.Sketch))
+	}
+	return rtn
+}
+
+// exportFormat picks the format from the file extension, csv by default
+func exportFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ExportJSON
+	}
+	return ExportCSV
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeCSV writes the buckets, a blank line and the stats, with a column
+// per series when grouping
+func (data ExportData) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	var labels []string
+	for _, s := range data.Series {
+		labels = append(labels, s.Label)
+	}
+	cw.Write(append([]string{"start", "end", "count"}, labels...))
+	for _, bucket := range data.Buckets {
+		row := []string{formatNumber(bucket.Start), formatNumber(bucket.End), strconv.Itoa(bucket.Count)}
+		for _, label := range labels {
+			row = append(row, strconv.Itoa(bucket.Series[label]))
+		}
+		cw.Write(row)
+	}
+	cw.Write(nil)
+	cw.Write(append([]string{"stat", "all"}, labels...))
+	all := append([]ExportStats{data.Stats}, data.Series...)
+	statRow := func(name string, get func(ExportStats) string) {
+		row := []string{name}
+		for _, stats := range all {
+			row = append(row, get(stats))
+		}
+		cw.Write(row)
+	}
+	statRow("count", func(s ExportStats) string { return strconv.FormatInt(s.Count, 10) })
+	statRow("min", func(s ExportStats) string { return formatNumber(s.Min) })
+	statRow("max", func(s ExportStats) string { return formatNumber(s.Max) })
+	statRow("mean", func(s ExportStats) string { return formatNumber(s.Mean) })
+	statRow("median", func(s ExportStats) string { return formatNumber(s.Median) })
+	statRow("stddev", func(s ExportStats) string { return formatNumber(s.StdDev) })
+	for _, p := range percentiles {
+		label := percentileLabel(p)
+		statRow(label, func(s ExportStats) string { return formatNumber(s.Percentiles[label]) })
+	}
+	if data.Unit != "" {
+		cw.Write([]string{"unit", data.Unit})
+	}
+	if data.Window != "" {
+		cw.Write([]string{"window", data.Window})
+	}
+	cw.Write([]string{"skipped", strconv.FormatInt(data.Skipped, 10)})
+	cw.Write([]string{"rejected", strconv.FormatInt(data.Rejected, 10)})
+	cw.Write([]string{"nonfinite", strconv.FormatInt(data.NonFinite, 10)})
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write writes data as csv or json
+func (data ExportData) Write(w io.Writer, format string) error {
+	if format == ExportJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	}
+	return data.writeCSV(w)
+}
+
+// writeExportFile writes data to path, "-" is stdout
+func writeExportFile(path string, format string, data ExportData) error {
+	if path == "-" {
+		return data.Write(os.Stdout, format)
+	}
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := data.Write(fd, format); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
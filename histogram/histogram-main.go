@@ -1,14 +1,13 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	_ "embed"
 	"flag"
 	"fmt"
 	"math"
 	"os"
-	"sort"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -24,129 +23,205 @@ var (
 	numBuckets = flag.Int("b", 10, "initial number of buckets")
 	minValue   = flag.Float64("min", math.NaN(), "minimum value (auto if not specified)")
 	maxValue   = flag.Float64("max", math.NaN(), "maximum value (auto if not specified)")
+	cdfFlag    = flag.Bool("cdf", false, "start in the cumulative distribution view")
+	outFlag    = flag.String("o", "", "write buckets and stats to this file when stdin closes, csv or json by extension (- for stdout)")
+	textFlag   = flag.Bool("text", false, "print the histogram as text when stdin closes instead of opening a Wave view")
+	maxFPS     = flag.Int("fps", 10, "maximum number of re-renders per second while data is coming in")
+	pctFlag    = flag.String("p", "50,90,95,99,99.9", "comma separated percentiles to show")
+	edgesFlag  = flag.String("buckets", "", "explicit bucket boundaries, e.g. 1,5,10,50,100 or 10ms,100ms,1s")
+	ruleFlag   = flag.String("rule", "", "pick the number of buckets automatically: fd (Freedman-Diaconis) or sturges")
+	logFlag    = flag.Bool("log", false, "logarithmically spaced buckets")
+	logCount   = flag.Bool("logcount", false, "logarithmic count axis")
+	formatFlag = flag.String("format", FormatAuto, "input format: auto, plain, csv, tsv or json (JSON lines)")
+	colFlag    = flag.String("col", "", "column of csv/tsv input, 1-based index or header name")
+	fieldFlag  = flag.String("field", "", "field of JSON lines input, dotted path like latency.ms")
+	reFlag     = flag.String("re", "", "regexp to extract the value, the first capture group is used (e.g. 'took (\\d+)ms')")
+	windowFlag = flag.String("window", "", "only keep the last N values (e.g. 1000, dropped in steps of N/10 so up to N+N/10 are shown) or the values of the last duration (e.g. 60s)")
+	groupFlag  = flag.String("group", "", "overlay one series per label: csv/tsv column, JSON field or for plain input the 1-based word of the line (1 for \"GET 12.3\")")
 )
 
-var AppClient = waveapp.MakeClient(waveapp.AppOpts{
-	CloseOnCtrlC: true,
-	GlobalStyles: styleCSS,
-})
+// percentiles is the parsed -p list
+var percentiles []float64
 
-type HistogramProps struct {
-	Values     []float64 `json:"values"`
-	NumBuckets int       `json:"numBuckets"`
-	MinValue   *float64  `json:"minValue"`
-	MaxValue   *float64  `json:"maxValue"`
-}
+// lineParser extracts values from stdin lines (-format, -col, -field, -re)
+var lineParser *LineParser
 
-type HistogramBucket struct {
-	Start  float64
-	End    float64
-	Count  int
-	Height int
-}
+// bucketEdgesFlag is the parsed -buckets list
+var bucketEdgesFlag []float64
 
-func calcStats(values []float64) (mean, median, stddev float64) {
-	if len(values) == 0 {
-		return 0, 0, 0
-	}
+// windowSpec is the parsed -window
+var windowSpec WindowSpec
 
-	// Calculate mean
-	sum := 0.0
-	for _, v := range values {
-		sum += v
+// flagBucketOpts are the bucket options given on the command line, used
+// for -o, -text and as the start of the view
+func flagBucketOpts() BucketOpts {
+	opts := BucketOpts{
+		NumBuckets: *numBuckets,
+		Rule:       *ruleFlag,
+		LogScale:   *logFlag,
+		Edges:      bucketEdgesFlag,
+	}
+	if !math.IsNaN(*minValue) {
+		opts.MinValue = minValue
 	}
-	mean = sum / float64(len(values))
-
-	// Calculate median
-	sorted := make([]float64, len(values))
-	copy(sorted, values)
-	sort.Float64s(sorted)
-	if len(sorted)%2 == 0 {
-		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
-	} else {
-		median = sorted[len(sorted)/2]
+	if !math.IsNaN(*maxValue) {
+		opts.MaxValue = maxValue
 	}
+	return opts
+}
 
-	// Calculate standard deviation
-	sumSquares := 0.0
-	for _, v := range values {
-		diff := v - mean
-		sumSquares += diff * diff
+// exportPath is where the export buttons write, next to -o if given
+func exportPath(format string) string {
+	base := "histogram-export"
+	if *outFlag != "" && *outFlag != "-" {
+		base = strings.TrimSuffix(*outFlag, filepath.Ext(*outFlag))
 	}
-	stddev = math.Sqrt(sumSquares / float64(len(values)))
+	return base + "." + format
+}
+
+// exportStore writes the store to -o, once stdin is closed
+func exportStore(store *SketchStore) {
+	sketch, series, status := store.Snapshot()
+	data := makeExport(sketch, series, status, flagBucketOpts())
+	if err := writeExportFile(*outFlag, exportFormat(*outFlag), data); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing -o: %v\n", err)
+	}
+}
+
+var AppClient = waveapp.MakeClient(waveapp.AppOpts{
+	CloseOnCtrlC: true,
+	GlobalStyles: styleCSS,
+})
+
+const (
+	ViewBars = "bars"
+	ViewCDF  = "cdf" // cumulative distribution
+)
 
-	return mean, median, stddev
+var viewLabels = map[string]string{
+	ViewBars: "Histogram",
+	ViewCDF:  "CDF",
+}
+
+// ZoomRange is one level of the click-to-zoom drill-down
+type ZoomRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+type HistogramProps struct {
+	Sketch    *Sketch                  `json:"sketch"`
+	Series    []Series                 `json:"series"`
+	Status    IngestStatus             `json:"status"`
+	Opts      BucketOpts               `json:"opts"`
+	LogCounts bool                     `json:"logCounts"`
+	Markers   []PercentileValue        `json:"markers"`
+	View      string                   `json:"view"`
+	OnZoom    func(start, end float64) `json:"onZoom"`
 }
 
 var Histogram = waveapp.DefineComponent[HistogramProps](AppClient, "Histogram",
 	func(ctx context.Context, props HistogramProps) any {
-		if len(props.Values) == 0 {
+		sketch := props.Sketch
+		if sketch == nil || sketch.Count == 0 {
 			return vdom.H("div", map[string]any{
 				"className": "histogram-empty",
-			}, "Waiting for data...")
+			}, vdom.IfElse(windowSpec.IsSet() && props.Status.Done, "No values in the "+windowSpec.Label(), "Waiting for data..."))
 		}
 
-		// Calculate data range and stats
-		min, max := props.Values[0], props.Values[0]
-		for _, v := range props.Values {
-			if v < min {
-				min = v
+		// Data range and stats come from the sketch, no per-value work here
+		min, max := sketch.Min, sketch.Max
+		mean, median, stddev := sketch.Mean(), sketch.Quantile(0.5), sketch.StdDev()
+
+		unit := props.Status.Unit
+		buckets, warning := makeBuckets(sketch, props.Opts)
+		logScale := props.Opts.LogScale && warning == ""
+		bucketMax := buckets[len(buckets)-1].End
+
+		// Percentile markers, drawn inside the column they fall in
+		markersAt := make(map[int][]any)
+		for _, marker := range props.Markers {
+			if !marker.Marked {
+				continue
 			}
-			if v > max {
-				max = v
+			if props.Opts.Clip && (marker.Value < buckets[0].Start || marker.Value > bucketMax) {
+				continue
 			}
+			idx, frac := markerPosition(buckets, marker.Value, logScale)
+			markersAt[idx] = append(markersAt[idx], vdom.H("div", map[string]any{
+				"key":       marker.Label,
+				"className": "percentile-marker",
+				"title":     marker.Label + ": " + unit.Format(marker.Value),
+				"style": map[string]any{
+					"left":        fmt.Sprintf("%.2f%%", frac*100),
+					"borderColor": marker.Color,
+				},
+			},
+				vdom.H("span", map[string]any{
+					"className": "percentile-marker-label",
+					"style": map[string]any{
+						"color": marker.Color,
+					},
+				}, marker.Label),
+			))
 		}
-		mean, median, stddev := calcStats(props.Values)
 
-		// Use provided min/max if set
-		bucketMin := min
-		if props.MinValue != nil {
-			bucketMin = *props.MinValue
+		const maxHeight = 20
+		scaleHeights(buckets, maxHeight, props.LogCounts)
+
+		// Grouped series share the buckets and are drawn on top of each other
+		grouped := len(props.Series) > 0
+		counts := seriesCounts(props.Series, buckets, logScale, props.Opts.Clip)
+		heights := seriesHeights(counts, maxHeight, props.LogCounts)
+
+		// CDF view: one step line for all values or one per series
+		isCDF := props.View == ViewCDF
+		type cdfLine struct {
+			Label string
+			Color string
+			Fracs []float64
 		}
-		bucketMax := max
-		if props.MaxValue != nil {
-			bucketMax = *props.MaxValue
+		var cdfLines []cdfLine
+		inRange := 0
+		for _, bucket := range buckets {
+			inRange += bucket.Count
 		}
-
-		// Create evenly spaced buckets
-		bucketSize := (bucketMax - bucketMin) / float64(props.NumBuckets)
-		buckets := make([]HistogramBucket, props.NumBuckets)
-
-		// Initialize bucket ranges
-		for i := range buckets {
-			buckets[i].Start = bucketMin + float64(i)*bucketSize
-			buckets[i].End = buckets[i].Start + bucketSize
-		}
-
-		// Fill buckets
-		maxCount := 0
-		for _, v := range props.Values {
-			bucketValue := v
-			if props.MinValue != nil && v < *props.MinValue {
-				bucketValue = *props.MinValue
-			}
-			if props.MaxValue != nil && v > *props.MaxValue {
-				bucketValue = *props.MaxValue
-			}
-
-			bucketIdx := int((bucketValue - bucketMin) / bucketSize)
-			if bucketIdx >= len(buckets) {
-				bucketIdx = len(buckets) - 1
+		if isCDF {
+			below := func(s *Sketch) float64 {
+				if !props.Opts.Clip {
+					return 0
+				}
+				return s.CountBelow(buckets[0].Start)
 			}
-			if bucketIdx >= 0 && bucketIdx < len(buckets) {
-				buckets[bucketIdx].Count++
-				if buckets[bucketIdx].Count > maxCount {
-					maxCount = buckets[bucketIdx].Count
+			if grouped {
+				for i, s := range props.Series {
+					cdfLines = append(cdfLines, cdfLine{s.Label, s.Color, cumulative(counts[i], below(s.Sketch), s.Sketch.Count)})
+				}
+			} else {
+				bucketCounts := make([]int, len(buckets))
+				for i, bucket := range buckets {
+					bucketCounts[i] = bucket.Count
 				}
+				cdfLines = append(cdfLines, cdfLine{"", "#2563eb", cumulative(bucketCounts, below(sketch), sketch.Count)})
 			}
 		}
 
-		// Normalize heights
-		const maxHeight = 20
-		for i := range buckets {
-			if maxCount > 0 {
-				buckets[i].Height = (buckets[i].Count * maxHeight) / maxCount
+		countLabel := func(idx int) string {
+			switch {
+			case isCDF:
+				parts := make([]string, len(cdfLines))
+				for i, line := range cdfLines {
+					parts[i] = strings.TrimSpace(fmt.Sprintf("%s ≤ %s: %.1f%%", line.Label, unit.FormatEdge(buckets[idx].End), line.Fracs[idx]*100))
+				}
+				return strings.Join(parts, ", ")
+			case !grouped:
+				return strconv.Itoa(buckets[idx].Count)
+			}
+			parts := make([]string, len(props.Series))
+			for i, s := range props.Series {
+				parts[i] = fmt.Sprintf("%s: %d", s.Label, counts[i][idx])
 			}
+			return strings.Join(parts, ", ")
 		}
 
 		return vdom.H("div", map[string]any{
@@ -156,14 +231,56 @@ var Histogram = waveapp.DefineComponent[HistogramProps](AppClient, "Histogram",
 			vdom.H("div", map[string]any{
 				"className": "histogram-stats",
 			},
-				"Count: ", len(props.Values),
-				" | Range: ", strconv.FormatFloat(min, 'f', 2, 64),
-				" - ", strconv.FormatFloat(max, 'f', 2, 64),
-				" | Mean: ", strconv.FormatFloat(mean, 'f', 2, 64),
-				" | Median: ", strconv.FormatFloat(median, 'f', 2, 64),
-				" | StdDev: ", strconv.FormatFloat(stddev, 'f', 2, 64),
+				"Count: ", sketch.Count,
+				" | Range: ", unit.Format(min),
+				" - ", unit.Format(max),
+				" | Mean: ", unit.Format(mean),
+				" | Median: ", unit.Format(median),
+				" | StdDev: ", unit.Format(stddev),
+				vdom.If(props.Opts.Clip, fmt.Sprintf(" | In range: %d", inRange)),
+				vdom.H("span", map[string]any{
+					"className": vdom.Classes(
+						"histogram-rate",
+						vdom.If(props.Status.Done, "done"),
+					),
+				}, vdom.IfElse(props.Status.Done, "stdin closed", formatRate(props.Status.Rate))),
+				vdom.If(windowSpec.IsSet(),
+					vdom.H("span", map[string]any{
+						"className": "histogram-window",
+						"title":     "Old values expire in steps of a tenth of the window",
+					}, fmt.Sprintf("%s, spanning %s", windowSpec.Label(), ValueUnit{Dim: DimDuration}.Format(props.Status.WindowSpan))),
+				),
+				vdom.If(props.Status.Skipped > 0,
+					vdom.H("span", map[string]any{
+						"className": "histogram-skipped",
+						"title":     "Last skipped line: " + props.Status.LastSkipped,
+					}, fmt.Sprintf("%d skipped", props.Status.Skipped)),
+				),
+				vdom.If(props.Status.NonFinite > 0,
+					vdom.H("span", map[string]any{
+						"className": "histogram-skipped",
+						"title":     "NaN and infinite values are not counted",
+					}, fmt.Sprintf("%d NaN/Inf", props.Status.NonFinite)),
+				),
+			),
+
+			vdom.If(props.Status.Rejected > 0,
+				vdom.H("div", map[string]any{
+					"className": "histogram-warning",
+				}, fmt.Sprintf("Mixed units: %d value(s) rejected, the stream is %s but got %q", props.Status.Rejected, unit.Name(), props.Status.LastRejected)),
 			),
 
+			vdom.If(warning != "",
+				vdom.H("div", map[string]any{
+					"className": "histogram-warning",
+				}, warning),
+			),
+
+			vdom.If(grouped, SeriesTable(SeriesTableProps{
+				Series: props.Series,
+				Unit:   unit,
+			})),
+
 			// Single scrolling container for both bars and labels
 			vdom.H("div", map[string]any{
 				"className": "histogram-scroll-container",
@@ -177,14 +294,74 @@ var Histogram = waveapp.DefineComponent[HistogramProps](AppClient, "Histogram",
 						return vdom.H("div", map[string]any{
 							"key":       idx,
 							"className": "histogram-column",
+							"title":     "Zoom into " + unit.FormatEdge(bucket.Start) + " - " + unit.FormatEdge(bucket.End),
+							"onClick":   func() { props.OnZoom(bucket.Start, bucket.End) },
 						},
 							// Count label (visible on hover)
 							vdom.H("div", map[string]any{
 								"className": "count-label",
-							}, strconv.Itoa(bucket.Count)),
+							}, countLabel(idx)),
+
+							// Cumulative step lines, the riser connects to the previous bucket
+							vdom.If(isCDF, vdom.H("div", map[string]any{
+								"className": "cdf-area",
+								"style": map[string]any{
+									"height": fmt.Sprintf("%dpx", maxHeight*8),
+								},
+							},
+								vdom.ForEachIdx(cdfLines, func(line cdfLine, i int) any {
+									prev := 0.0
+									if idx > 0 {
+										prev = line.Fracs[idx-1]
+									}
+									return []any{
+										vdom.H("div", map[string]any{
+											"key":       fmt.Sprintf("step-%d", i),
+											"className": vdom.Classes("cdf-step", vdom.If(!grouped, "filled")),
+											"style": map[string]any{
+												"height":         fmt.Sprintf("%.1f%%", line.Fracs[idx]*100),
+												"borderTopColor": line.Color,
+											},
+										}),
+										vdom.H("div", map[string]any{
+											"key":       fmt.Sprintf("riser-%d", i),
+											"className": "cdf-riser",
+											"style": map[string]any{
+												"bottom":          fmt.Sprintf("%.1f%%", prev*100),
+												"height":          fmt.Sprintf("%.1f%%", (line.Fracs[idx]-prev)*100),
+												"borderLeftColor": line.Color,
+											},
+										}),
+									}
+								}),
+							)),
+
+							// Overlaid series bars
+							vdom.If(grouped && !isCDF, vdom.H("div", map[string]any{
+								"className": "series-bars",
+								"style": map[string]any{
+									"height": fmt.Sprintf("%dpx", maxHeight*8),
+								},
+							},
+								vdom.ForEachIdx(props.Series, func(s Series, i int) any {
+									return vdom.H("div", map[string]any{
+										"key":       s.Label,
+										"className": "series-bar",
+										"style": map[string]any{
+											"height": func() string {
+												if counts[i][idx] == 0 {
+													return "1px"
+												}
+												return fmt.Sprintf("%dpx", heights[i][idx]*8)
+											}(),
+											"background": s.Color,
+										},
+									})
+								}),
+							)),
 
 							// Bar
-							vdom.H("div", map[string]any{
+							vdom.If(!grouped && !isCDF, vdom.H("div", map[string]any{
 								"className": vdom.Classes(
 									"bar",
 									vdom.If(bucket.Count == 0, "empty"),
@@ -197,12 +374,14 @@ var Histogram = waveapp.DefineComponent[HistogramProps](AppClient, "Histogram",
 										return fmt.Sprintf("%dpx", bucket.Height*8)
 									}(),
 								},
-							}),
+							})),
 
 							// Label for left boundary
 							vdom.H("div", map[string]any{
 								"className": "x-label",
-							}, strconv.FormatFloat(bucket.Start, 'f', 1, 64)),
+							}, unit.FormatEdge(bucket.Start)),
+
+							markersAt[idx],
 						)
 					}),
 
@@ -212,7 +391,7 @@ var Histogram = waveapp.DefineComponent[HistogramProps](AppClient, "Histogram",
 					},
 						vdom.H("div", map[string]any{
 							"className": "x-label",
-						}, strconv.FormatFloat(bucketMax, 'f', 1, 64)),
+						}, unit.FormatEdge(bucketMax)),
 					),
 				),
 			),
@@ -220,52 +399,232 @@ var Histogram = waveapp.DefineComponent[HistogramProps](AppClient, "Histogram",
 	},
 )
 
+type SeriesTableProps struct {
+	Series []Series  `json:"series"`
+	Unit   ValueUnit `json:"unit"`
+}
+
+// SeriesTable is the legend of the grouped series with a stats row each
+var SeriesTable = waveapp.DefineComponent[SeriesTableProps](AppClient, "SeriesTable",
+	func(ctx context.Context, props SeriesTableProps) any {
+		headers := []string{"Series", "Count", "Mean", "Median", "StdDev"}
+		for _, p := range percentiles {
+			headers = append(headers, percentileLabel(p))
+		}
+		return vdom.H("table", map[string]any{
+			"className": "series-table",
+		},
+			vdom.H("thead", nil,
+				vdom.H("tr", nil,
+					vdom.ForEach(headers, func(h string) any {
+						return vdom.H("th", map[string]any{"key": h}, h)
+					}),
+				),
+			),
+			vdom.H("tbody", nil,
+				vdom.ForEach(props.Series, func(s Series) any {
+					sketch := s.Sketch
+					return vdom.H("tr", map[string]any{
+						"key": s.Label,
+					},
+						vdom.H("td", nil,
+							vdom.H("span", map[string]any{
+								"className": "percentile-swatch",
+								"style": map[string]any{
+									"background": s.Color,
+								},
+							}),
+							" ", s.Label,
+						),
+						vdom.H("td", nil, sketch.Count),
+						vdom.H("td", nil, props.Unit.Format(sketch.Mean())),
+						vdom.H("td", nil, props.Unit.Format(sketch.Quantile(0.5))),
+						vdom.H("td", nil, props.Unit.Format(sketch.StdDev())),
+						vdom.ForEach(percentiles, func(p float64) any {
+							return vdom.H("td", map[string]any{
+								"key": percentileLabel(p),
+							}, props.Unit.Format(sketch.Quantile(p/100)))
+						}),
+					)
+				}),
+			),
+		)
+	},
+)
+
+type ZoomBreadcrumbProps struct {
+	Zoom     []ZoomRange `json:"zoom"`
+	Unit     ValueUnit   `json:"unit"`
+	OnSelect func(int)   `json:"onSelect"`
+}
+
+// ZoomBreadcrumb shows the zoom levels, clicking one zooms back out to it
+var ZoomBreadcrumb = waveapp.DefineComponent[ZoomBreadcrumbProps](AppClient, "ZoomBreadcrumb",
+	func(ctx context.Context, props ZoomBreadcrumbProps) any {
+		crumb := func(level int, label string) any {
+			current := level == len(props.Zoom)
+			return vdom.H("span", map[string]any{
+				"key": level,
+				"className": vdom.Classes(
+					"crumb",
+					vdom.If(current, "current"),
+				),
+				"onClick": func() {
+					if !current {
+						props.OnSelect(level)
+					}
+				},
+			}, label)
+		}
+		items := []any{crumb(0, "All")}
+		for idx, zr := range props.Zoom {
+			items = append(items,
+				vdom.H("span", map[string]any{
+					"key":       fmt.Sprintf("sep-%d", idx),
+					"className": "crumb-sep",
+				}, "›"),
+				crumb(idx+1, props.Unit.FormatEdge(zr.Min)+" - "+props.Unit.FormatEdge(zr.Max)),
+			)
+		}
+		return vdom.H("div", map[string]any{
+			"className": "zoom-breadcrumb",
+		},
+			items,
+			vdom.If(len(props.Zoom) == 0,
+				vdom.H("span", map[string]any{
+					"className": "crumb-hint",
+				}, "click a column to zoom in"),
+			),
+		)
+	},
+)
+
+type PercentilesPanelProps struct {
+	Values   []PercentileValue `json:"values"`
+	Unit     ValueUnit         `json:"unit"`
+	OnToggle func(string)      `json:"onToggle"`
+}
+
+var PercentilesPanel = waveapp.DefineComponent[PercentilesPanelProps](AppClient, "PercentilesPanel",
+	func(ctx context.Context, props PercentilesPanelProps) any {
+		return vdom.H("div", map[string]any{
+			"className": "percentiles",
+		},
+			vdom.ForEach(props.Values, func(pv PercentileValue) any {
+				return vdom.H("div", map[string]any{
+					"key": pv.Label,
+					"className": vdom.Classes(
+						"percentile",
+						vdom.If(!pv.Marked, "unmarked"),
+					),
+					"onClick": func() { props.OnToggle(pv.Label) },
+					"title":   "Show or hide the marker",
+				},
+					vdom.H("span", map[string]any{
+						"className": "percentile-swatch",
+						"style": map[string]any{
+							"background": pv.Color,
+						},
+					}),
+					vdom.H("span", map[string]any{
+						"className": "percentile-label",
+					}, pv.Label),
+					vdom.H("span", map[string]any{
+						"className": "percentile-value",
+					}, props.Unit.Format(pv.Value)),
+				)
+			}),
+		)
+	},
+)
+
 var App = waveapp.DefineComponent(AppClient, "App",
 	func(ctx context.Context, _ any) any {
 		// Initialize with CLI values
-		initialMin := (*float64)(nil)
-		if !math.IsNaN(*minValue) {
-			initialMin = minValue
-		}
-		initialMax := (*float64)(nil)
-		if !math.IsNaN(*maxValue) {
-			initialMax = maxValue
+		initialView := ViewBars
+		if *cdfFlag {
+			initialView = ViewCDF
 		}
 
-		values, _, setValuesFn := vdom.UseStateWithFn(ctx, []float64{})
+		// The reader goroutine adds to the shared sketch, the publisher
+		// re-renders at most *maxFPS times per second and renders take a copy
+		store := vdom.UseRef(ctx, MakeSketchStore(windowSpec))
+		_, _, setVersionFn := vdom.UseStateWithFn(ctx, int64(0))
 		numBuckets, setNumBuckets := vdom.UseState(ctx, *numBuckets)
-		minValue, setMinValue := vdom.UseState(ctx, (*float64)(initialMin))
-		maxValue, setMaxValue := vdom.UseState(ctx, (*float64)(initialMax))
+		zoom, setZoom := vdom.UseState(ctx, []ZoomRange{})
+		view, setView := vdom.UseState(ctx, initialView)
+		unmarked, setUnmarked := vdom.UseState(ctx, map[string]bool{})
+		rule, setRule := vdom.UseState(ctx, *ruleFlag)
+		logScale, setLogScale := vdom.UseState(ctx, *logFlag)
+		logCounts, setLogCounts := vdom.UseState(ctx, *logCount)
+		exportMsg, setExportMsg := vdom.UseState(ctx, "")
 
 		vdom.UseEffect(ctx, func() func() {
 			done := make(chan bool)
 
 			go func() {
-				defer close(done)
-				scanner := bufio.NewScanner(os.Stdin)
-				for scanner.Scan() {
-					line := strings.TrimSpace(scanner.Text())
-					if line == "" {
-						continue
-					}
-
-					if num, err := strconv.ParseFloat(line, 64); err == nil {
-						setValuesFn(func(currentValues []float64) []float64 {
-							newValues := make([]float64, len(currentValues)+1)
-							copy(newValues, currentValues)
-							newValues[len(currentValues)] = num
-							return newValues
-						})
-						AppClient.SendAsyncInitiation()
-					}
+				readValues(os.Stdin, lineParser, store.Current)
+				if *outFlag != "" {
+					exportStore(store.Current)
 				}
 			}()
+			go publishUpdates(store.Current, *maxFPS, func() {
+				setVersionFn(func(version int64) int64 { return version + 1 })
+				AppClient.SendAsyncInitiation()
+			}, done)
 
 			return func() {
-				<-done
+				close(done)
 			}
 		}, []any{})
 
+		sketch, series, status := store.Current.Snapshot()
+		var pcts []PercentileValue
+		if sketch.Count > 0 {
+			pcts = calcPercentiles(sketch, percentiles, unmarked)
+		}
+
+		// Bucket options, a zoom level replaces the -min/-max range and
+		// leaves out the values outside it
+		opts := flagBucketOpts()
+		opts.NumBuckets = numBuckets
+		opts.Rule = rule
+		opts.LogScale = logScale
+		if len(zoom) > 0 {
+			cur := zoom[len(zoom)-1]
+			opts.Edges = nil
+			opts.MinValue = &cur.Min
+			opts.MaxValue = &cur.Max
+			opts.Clip = true
+		}
+		zoomIn := func(start, end float64) {
+			if end <= start {
+				return
+			}
+			setZoom(append(append([]ZoomRange{}, zoom...), ZoomRange{Min: start, Max: end}))
+		}
+
+		exportView := func(format string) {
+			path := exportPath(format)
+			if absPath, err := filepath.Abs(path); err == nil {
+				path = absPath
+			}
+			if err := writeExportFile(path, format, makeExport(sketch, series, status, opts)); err != nil {
+				setExportMsg("Export failed: " + err.Error())
+				return
+			}
+			setExportMsg("Exported to " + path)
+		}
+
+		toggleMarker := func(label string) {
+			newUnmarked := make(map[string]bool)
+			for k, v := range unmarked {
+				newUnmarked[k] = v
+			}
+			newUnmarked[label] = !unmarked[label]
+			setUnmarked(newUnmarked)
+		}
+
 		return vdom.H("div", map[string]any{
 			"className": "app",
 		},
@@ -277,8 +636,9 @@ var App = waveapp.DefineComponent(AppClient, "App",
 				},
 					vdom.H("label", nil, "Number of buckets: "),
 					vdom.H("input", map[string]any{
-						"type":  "text",
-						"value": numBuckets,
+						"type":     "text",
+						"value":    numBuckets,
+						"disabled": rule != RuleManual || len(bucketEdgesFlag) > 0,
 						"onChange": func(e vdom.VDomEvent) {
 							if n, err := strconv.Atoi(e.TargetValue); err == nil && n >= 2 && n <= 100 {
 								setNumBuckets(n)
@@ -292,66 +652,98 @@ var App = waveapp.DefineComponent(AppClient, "App",
 				vdom.H("div", map[string]any{
 					"className": "control-group",
 				},
-					vdom.H("label", nil, "Min value: "),
-					vdom.H("input", map[string]any{
-						"type": "text",
-						"value": func() string {
-							if minValue != nil {
-								return strconv.FormatFloat(*minValue, 'f', -1, 64)
-							}
-							return ""
-						}(),
-						"placeholder": "auto",
-						"onChange": func(e vdom.VDomEvent) {
-							if e.TargetValue == "" {
-								setMinValue(nil)
-							} else if val, err := strconv.ParseFloat(e.TargetValue, 64); err == nil {
-								setMinValue(&val)
-							}
-						},
+					vdom.H("label", nil, "Auto: "),
+					vdom.ForEach([]string{RuleManual, RuleFD, RuleSturges}, func(r string) any {
+						return vdom.H("button", map[string]any{
+							"key": r,
+							"className": vdom.Classes(
+								"toggle-btn",
+								vdom.If(rule == r, "active"),
+							),
+							"onClick": func() { setRule(r) },
+						}, ruleLabels[r])
 					}),
-					vdom.If(minValue != nil,
-						vdom.H("button", map[string]any{
-							"onClick":   func() { setMinValue(nil) },
-							"className": "clear-btn",
-						}, "×"),
+				),
+
+				vdom.H("div", map[string]any{
+					"className": "control-group",
+				},
+					vdom.H("label", nil,
+						vdom.H("input", map[string]any{
+							"type":     "checkbox",
+							"checked":  logScale,
+							"onChange": func() { setLogScale(!logScale) },
+						}),
+						" Log buckets",
+					),
+					vdom.H("label", nil,
+						vdom.H("input", map[string]any{
+							"type":     "checkbox",
+							"checked":  logCounts,
+							"onChange": func() { setLogCounts(!logCounts) },
+						}),
+						" Log counts",
 					),
 				),
 
 				vdom.H("div", map[string]any{
 					"className": "control-group",
 				},
-					vdom.H("label", nil, "Max value: "),
-					vdom.H("input", map[string]any{
-						"type": "text",
-						"value": func() string {
-							if maxValue != nil {
-								return strconv.FormatFloat(*maxValue, 'f', -1, 64)
-							}
-							return ""
-						}(),
-						"placeholder": "auto",
-						"onChange": func(e vdom.VDomEvent) {
-							if e.TargetValue == "" {
-								setMaxValue(nil)
-							} else if val, err := strconv.ParseFloat(e.TargetValue, 64); err == nil {
-								setMaxValue(&val)
-							}
-						},
+					vdom.H("label", nil, "View: "),
+					vdom.ForEach([]string{ViewBars, ViewCDF}, func(v string) any {
+						return vdom.H("button", map[string]any{
+							"key": v,
+							"className": vdom.Classes(
+								"toggle-btn",
+								vdom.If(view == v, "active"),
+							),
+							"onClick": func() { setView(v) },
+						}, viewLabels[v])
+					}),
+				),
+
+				vdom.H("div", map[string]any{
+					"className": "control-group",
+				},
+					vdom.H("label", nil, "Export: "),
+					vdom.ForEach([]string{ExportCSV, ExportJSON}, func(format string) any {
+						return vdom.H("button", map[string]any{
+							"key":       format,
+							"className": "toggle-btn",
+							"disabled":  sketch.Count == 0,
+							"onClick":   func() { exportView(format) },
+						}, strings.ToUpper(format))
 					}),
-					vdom.If(maxValue != nil,
-						vdom.H("button", map[string]any{
-							"onClick":   func() { setMaxValue(nil) },
-							"className": "clear-btn",
-						}, "×"),
+					vdom.If(exportMsg != "",
+						vdom.H("span", map[string]any{
+							"className": "export-msg",
+						}, exportMsg),
 					),
 				),
 			),
+			vdom.If(len(pcts) > 0,
+				PercentilesPanel(PercentilesPanelProps{
+					Values:   pcts,
+					Unit:     status.Unit,
+					OnToggle: toggleMarker,
+				}),
+			),
+			vdom.If(sketch.Count > 0,
+				ZoomBreadcrumb(ZoomBreadcrumbProps{
+					Zoom:     zoom,
+					Unit:     status.Unit,
+					OnSelect: func(level int) { setZoom(zoom[:level]) },
+				}),
+			),
 			Histogram(HistogramProps{
-				Values:     values,
-				NumBuckets: numBuckets,
-				MinValue:   minValue,
-				MaxValue:   maxValue,
+				Sketch:    sketch,
+				Series:    series,
+				Status:    status,
+				Opts:      opts,
+				LogCounts: logCounts,
+				Markers:   pcts,
+				View:      view,
+				OnZoom:    zoomIn,
 			}),
 		)
 	},
@@ -372,6 +764,49 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Number of buckets must be at most 100\n")
 		os.Exit(1)
 	}
+	var err error
+	percentiles, err = parsePercentiles(*pctFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	lineParser, err = makeLineParser(*formatFlag, *colFlag, *fieldFlag, *reFlag, *groupFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if *edgesFlag != "" {
+		bucketEdgesFlag, err = parseEdges(*edgesFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	windowSpec, err = parseWindow(*windowFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if *ruleFlag != RuleManual && *ruleFlag != RuleFD && *ruleFlag != RuleSturges {
+		fmt.Fprintf(os.Stderr, "-rule must be fd or sturges\n")
+		os.Exit(1)
+	}
+	if *maxFPS < 1 || *maxFPS > 60 {
+		fmt.Fprintf(os.Stderr, "-fps must be between 1 and 60\n")
+		os.Exit(1)
+	}
+
+	// Text mode reads everything and prints once, no Wave needed
+	if *textFlag {
+		store := MakeSketchStore(windowSpec)
+		readValues(os.Stdin, lineParser, store)
+		sketch, series, status := store.Snapshot()
+		renderText(os.Stdout, sketch, series, status, flagBucketOpts(), *logCount)
+		if *outFlag != "" {
+			exportStore(store)
+		}
+		return
+	}
 
 	AppClient.RunMain()
 }
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ingestBatchSize is the most values the reader collects before taking
+// the store lock
+const ingestBatchSize = 4096
+
+// rateInterval is how often the ingest rate is recomputed
+const rateInterval = time.Second
+
+// IngestStatus is what the stats header shows about the input
+type IngestStatus struct {
+	Rate        float64 `json:"rate"`        // values per second over the last interval
+	Done        bool    `json:"done"`        // stdin was closed
+	Skipped     int64   `json:"skipped"`     // lines without a parseable value
+	LastSkipped string  `json:"lastSkipped"` // most recent skipped line, to show why
+
+	Unit         ValueUnit `json:"unit"`         // unit of the stream, from the first value
+	Rejected     int64     `json:"rejected"`     // values in a unit incompatible with Unit
+	LastRejected string    `json:"lastRejected"` // most recent rejected line
+
+	NonFinite int64 `json:"nonFinite"` // NaN and ±Inf values, which the sketch cannot hold
+
+	WindowSpan float64 `json:"windowSpan"` // seconds covered by the -window
+}
+
+// ingestDelta is what the reader accumulated since its last batch
+type ingestDelta struct {
+	Skipped      int64
+	LastSkipped  string
+	Rejected     int64
+	LastRejected string
+	NonFinite    int64
+	Unit         *ValueUnit // set once, with the first value
+}
+
+// SketchStore is shared between the stdin reader and the render loop
+type SketchStore struct {
+	Lock     sync.Mutex
+	Window   WindowSpec
+	Panes    []*sketchPane // oldest first, a single pane without a window
+	Labels   []string      // group labels in order of appearance
+	labelSet map[string]bool
+	Status   IngestStatus
+	Total    int64 // values added so far (not counting non-finite ones)
+	Version  int64 // bumped on every change, so the publisher knows when to render
+}
+
+func MakeSketchStore(window WindowSpec) *SketchStore {
+	return &SketchStore{
+		Window:   window,
+		Panes:    []*sketchPane{makeSketchPane(time.Now())},
+		labelSet: make(map[string]bool),
+	}
+}
+
+// seriesLabel registers label, labels past maxSeries share one series
+func (store *SketchStore) seriesLabel(label string) string {
+	if store.labelSet[label] {
+		return label
+	}
+	if len(store.Labels) >= maxSeries-1 {
+		label = otherSeries
+		if store.labelSet[label] {
+			return label
+		}
+	}
+	store.labelSet[label] = true
+	store.Labels = append(store.Labels, label)
+	return label
+}
+
+// pane returns the pane new values go to, starting a new one when the
+// current pane covers its share of the window
+func (store *SketchStore) pane(now time.Time) *sketchPane {
+	cur := store.Panes[len(store.Panes)-1]
+	if cur.full(store.Window, now) {
+		cur = makeSketchPane(now)
+		store.Panes = append(store.Panes, cur)
+		store.Panes = expirePanes(store.Panes, store.Window, now)
+	}
+	return cur
+}
+
+// AddBatch adds values, labels holds the group of each value when grouping
+func (store *SketchStore) AddBatch(values []float64, labels []string, delta ingestDelta) {
+	store.Lock.Lock()
+	defer store.Lock.Unlock()
+	now := time.Now()
+	for idx, v := range values {
+		pane := store.pane(now)
+		pane.Sketch.Add(v)
+		if labels != nil {
+			pane.group(store.seriesLabel(labels[idx])).Add(v)
+		}
+	}
+	if delta.Unit != nil {
+		store.Status.Unit = *delta.Unit
+	}
+	if delta.Skipped > 0 {
+		store.Status.Skipped += delta.Skipped
+		store.Status.LastSkipped = delta.LastSkipped
+	}
+	if delta.Rejected > 0 {
+		store.Status.Rejected += delta.Rejected
+		store.Status.LastRejected = delta.LastRejected
+	}
+	store.Status.NonFinite += delta.NonFinite
+	store.Total += int64(len(values))
+	store.Version++
+}
+
+// Expire drops the panes of a time window that fell out of it, also when
+// no values come in
+func (store *SketchStore) Expire(now time.Time) {
+	store.Lock.Lock()
+	defer store.Lock.Unlock()
+	if store.Window.Span == 0 {
+		return
+	}
+	panes := expirePanes(store.Panes, store.Window, now)
+	if len(panes) == len(store.Panes) {
+		return
+	}
+	if len(panes) == 0 {
+		panes = []*sketchPane{makeSketchPane(now)}
+	}
+	store.Panes = panes
+	store.Version++
+}
+
+func (store *SketchStore) SetDone() {
+	store.Lock.Lock()
+	defer store.Lock.Unlock()
+	store.Status.Done = true
+	store.Status.Rate = 0
+	store.Version++
+}
+
+// Snapshot returns a copy of the sketches that is safe to read while
+// values keep coming in. With a window the panes are merged and the status
+// has the time the window spans.
+func (store *SketchStore) Snapshot() (*Sketch, []Series, IngestStatus) {
+	store.Lock.Lock()
+	defer store.Lock.Unlock()
+	sketch := mergePanes(store.Panes, func(pane *sketchPane) *Sketch { return pane.Sketch })
+	var series []Series
+	for idx, label := range store.Labels {
+		groupSketch := mergePanes(store.Panes, func(pane *sketchPane) *Sketch { return pane.Groups[label] })
+		if groupSketch == nil || groupSketch.Count == 0 {
+			continue
+		}
+		series = append(series, Series{
+			Label:  label,
+			Color:  seriesColors[idx%len(seriesColors)],
+			Sketch: groupSketch,
+		})
+	}
+	status := store.Status
+	if store.Window.IsSet() {
+		status.WindowSpan = time.Since(store.Panes[0].Start).Seconds()
+	}
+	return sketch, series, status
+}
+
+// maxSkippedLen truncates the skipped line shown in the header
+const maxSkippedLen = 80
+
+func truncateLine(line string) string {
+	if len(line) > maxSkippedLen {
+		return line[:maxSkippedLen] + "..."
+	}
+	return line
+}
+
+// readValues parses r into the store. Values are handed over in batches,
+// a batch is flushed when full or when no more input is buffered (so a
+// slow producer is still shown right away). The first value fixes the
+// unit of the stream, values in other units are rejected. A bare 0 fits
+// any unit, so it does not fix the unit and is never rejected.
+func readValues(r io.Reader, parser *LineParser, store *SketchStore) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	batch := make([]float64, 0, ingestBatchSize)
+	var labels []string
+	if parser.Group != "" {
+		labels = make([]string, 0, ingestBatchSize)
+	}
+	var delta ingestDelta
+	var unit *ValueUnit
+	bareZeros := true // every value so far was a bare 0
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" {
+			num, lineUnit, label, ok, header := parser.Parse(line)
+			if ok && bareZeros {
+				unit = &lineUnit
+				delta.Unit = unit
+				bareZeros = num == 0 && lineUnit.Dim == DimNone
+			}
+			switch {
+			case header:
+			case !ok:
+				delta.Skipped++
+				delta.LastSkipped = truncateLine(line)
+			case !unit.accepts(num, lineUnit):
+				delta.Rejected++
+				delta.LastRejected = truncateLine(line)
+			case math.IsNaN(num) || math.IsInf(num, 0):
+				delta.NonFinite++
+			default:
+				batch = append(batch, num)
+				if labels != nil {
+					labels = append(labels, label)
+				}
+			}
+		}
+		pending := len(batch) > 0 || delta != (ingestDelta{})
+		if pending && (len(batch) >= ingestBatchSize || reader.Buffered() == 0 || err != nil) {
+			store.AddBatch(batch, labels, delta)
+			batch = batch[:0]
+			if labels != nil {
+				labels = labels[:0]
+			}
+			delta = ingestDelta{}
+		}
+		if err != nil {
+			break
+		}
+	}
+	store.SetDone()
+}
+
+// publishUpdates triggers at most maxFPS renders per second while the
+// store changes, and keeps the ingest rate up to date
+func publishUpdates(store *SketchStore, maxFPS int, publish func(), done chan bool) {
+	ticker := time.NewTicker(time.Second / time.Duration(maxFPS))
+	defer ticker.Stop()
+	var published int64
+	rateTime := time.Now()
+	var rateCount int64
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			store.Expire(now)
+			store.Lock.Lock()
+			if elapsed := now.Sub(rateTime); elapsed >= rateInterval && !store.Status.Done {
+				rate := float64(store.Total-rateCount) / elapsed.Seconds()
+				if rate != store.Status.Rate {
+					store.Status.Rate = rate
+					store.Version++
+				}
+				rateCount = store.Total
+				rateTime = now
+			}
+			version := store.Version
+			store.Lock.Unlock()
+			if version != published {
+				published = version
+				publish()
+			}
+		}
+	}
+}
+
+// formatRate formats a values/second rate compactly (e.g. "12.5k/s")
+func formatRate(rate float64) string {
+	switch {
+	case rate >= 1e6:
+		return strconv.FormatFloat(rate/1e6, 'f', 1, 64) + "M/s"
+	case rate >= 1e3:
+		return strconv.FormatFloat(rate/1e3, 'f', 1, 64) + "k/s"
+	}
+	return strconv.FormatFloat(rate, 'f', 0, 64) + "/s"
+}
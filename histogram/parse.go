@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatAuto  = "auto"
+	FormatPlain = "plain" // one number per line
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+	FormatJSON  = "json" // JSON lines
+)
+
+// LineParser extracts the value text from an input line: a column of
+// delimited data (-col), a field of JSON lines (-field), the first capture
+// group of a regexp (-re, applied to the extracted text) or the whole line.
+// With -group it also extracts the series label: a column, a JSON field or
+// for plain input a word of the line.
+type LineParser struct {
+	Format     string
+	Col        string
+	Field      []string
+	Re         *regexp.Regexp
+	Group      string
+	GroupField []string
+	colIdx     int // 0-based, -1 until resolved from the header
+	groupIdx   int // same for the group column
+}
+
+// resolveColumn parses a 1-based column index, names are resolved from
+// the header line later (-1)
+func resolveColumn(flagName string, col string) (int, error) {
+	idx, err := strconv.Atoi(col)
+	if err != nil {
+		return -1, nil
+	}
+	if idx < 1 {
+		return 0, fmt.Errorf("%s index starts at 1", flagName)
+	}
+	return idx - 1, nil
+}
+
+func makeLineParser(format string, col string, field string, re string, group string) (*LineParser, error) {
+	parser := &LineParser{Format: format, Col: col, Group: group, colIdx: -1, groupIdx: -1}
+	switch format {
+	case FormatAuto, FormatPlain, FormatCSV, FormatTSV, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown -format %q (auto, plain, csv, tsv or json)", format)
+	}
+	if col != "" && field != "" {
+		return nil, fmt.Errorf("-col and -field cannot be used together")
+	}
+	if field != "" {
+		parser.Field = strings.Split(field, ".")
+		if format == FormatAuto {
+			parser.Format = FormatJSON
+		}
+	}
+	if col != "" {
+		idx, err := resolveColumn("-col", col)
+		if err != nil {
+			return nil, err
+		}
+		parser.colIdx = idx
+	}
+	if re != "" {
+		compiled, err := regexp.Compile(re)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -re: %w", err)
+		}
+		parser.Re = compiled
+	}
+	if col == "" && parser.Format == FormatAuto {
+		parser.Format = FormatPlain
+	}
+	if group != "" {
+		switch {
+		case parser.Format == FormatJSON:
+			parser.GroupField = strings.Split(group, ".")
+		case parser.Format == FormatPlain:
+			// "GET 12.3": the label is a word, the value the rest of the line
+			idx, err := strconv.Atoi(group)
+			if err != nil || idx < 1 {
+				return nil, fmt.Errorf("-group for plain input is the 1-based word of the line holding the label")
+			}
+			parser.groupIdx = idx - 1
+		case col == "":
+			return nil, fmt.Errorf("-group for %s input needs -col for the value", parser.Format)
+		default:
+			idx, err := resolveColumn("-group", group)
+			if err != nil {
+				return nil, err
+			}
+			parser.groupIdx = idx
+		}
+	}
+	return parser, nil
+}
+
+// splitFields splits a delimited line, csv honours quoting
+func (p *LineParser) splitFields(line string) ([]string, error) {
+	if p.Format == FormatTSV {
+		return strings.Split(line, "\t"), nil
+	}
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
+
+// extractColumn returns the -col field and the -group field. ok is false
+// for lines without the columns, header is true for the header line that
+// named them.
+func (p *LineParser) extractColumn(line string) (text string, label string, ok bool, header bool) {
+	if p.Format == FormatAuto {
+		// tabs and no commas means tsv
+		p.Format = FormatCSV
+		if strings.Contains(line, "\t") && !strings.Contains(line, ",") {
+			p.Format = FormatTSV
+		}
+	}
+	fields, err := p.splitFields(line)
+	if err != nil {
+		return "", "", false, false
+	}
+	grouped := p.Group != ""
+	if p.colIdx < 0 || (grouped && p.groupIdx < 0) {
+		for idx, name := range fields {
+			switch strings.TrimSpace(name) {
+			case p.Col:
+				if p.colIdx < 0 {
+					p.colIdx = idx
+					header = true
+				}
+			case p.Group:
+				if grouped && p.groupIdx < 0 {
+					p.groupIdx = idx
+					header = true
+				}
+			}
+		}
+		return "", "", false, header
+	}
+	if p.colIdx >= len(fields) || (grouped && p.groupIdx >= len(fields)) {
+		return "", "", false, false
+	}
+	if grouped {
+		label = strings.TrimSpace(fields[p.groupIdx])
+	}
+	return fields[p.colIdx], label, true, false
+}
+
+// extractWord splits a plain line into the -group word and the rest
+func (p *LineParser) extractWord(line string) (text string, label string, ok bool) {
+	words := strings.Fields(line)
+	if p.groupIdx >= len(words) || len(words) < 2 {
+		return "", "", false
+	}
+	label = words[p.groupIdx]
+	rest := append(words[:p.groupIdx:p.groupIdx], words[p.groupIdx+1:]...)
+	return strings.Join(rest, " "), label, true
+}
+
+// extractField follows path ("a.b.0.c") through a decoded JSON line
+func extractField(cur any, path []string) (string, bool) {
+	for _, part := range path {
+		switch node := cur.(type) {
+		case map[string]any:
+			cur = node[part]
+		case []any:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", false
+			}
+			cur = node[idx]
+		default:
+			return "", false
+		}
+	}
+	switch val := cur.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64), true
+	case string:
+		return val, true
+	}
+	return "", false
+}
+
+// extractJSON returns the -field and -group fields of a JSON line
+func (p *LineParser) extractJSON(line string) (text string, label string, ok bool) {
+	var doc any
+	if err := json.Unmarshal([]byte(line), &doc); err != nil {
+		return "", "", false
+	}
+	if text, ok = extractField(doc, p.Field); !ok {
+		return "", "", false
+	}
+	if p.GroupField != nil {
+		if label, ok = extractField(doc, p.GroupField); !ok {
+			return "", "", false
+		}
+	}
+	return text, label, true
+}
+
+// Extract returns the value text and series label of line. header is
+// true for a header line, which is not counted as skipped.
+func (p *LineParser) Extract(line string) (text string, label string, ok bool, header bool) {
+	text = line
+	switch {
+	case p.Col != "":
+		text, label, ok, header = p.extractColumn(line)
+		if !ok {
+			return "", "", false, header
+		}
+	case p.Format == FormatJSON:
+		text, label, ok = p.extractJSON(line)
+		if !ok {
+			return "", "", false, false
+		}
+	case p.Group != "":
+		text, label, ok = p.extractWord(line)
+		if !ok {
+			return "", "", false, false
+		}
+	}
+	if p.Re != nil {
+		match := p.Re.FindStringSubmatch(text)
+		if match == nil {
+			return "", "", false, false
+		}
+		text = match[0]
+		if len(match) > 1 {
+			text = match[1]
+		}
+	}
+	return strings.TrimSpace(text), label, true, false
+}
+
+// Parse extracts and parses the value of line, normalized to the base
+// unit if it has a unit suffix
+func (p *LineParser) Parse(line string) (num float64, unit ValueUnit, label string, ok bool, header bool) {
+	text, label, ok, header := p.Extract(line)
+	if !ok {
+		return 0, ValueUnit{}, "", false, header
+	}
+	num, unit, ok = parseValue(text)
+	return num, unit, label, ok, false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// markerColors are cycled through for the percentile markers
+var markerColors = []string{"#f59e0b", "#ef4444", "#a855f7", "#ec4899", "#14b8a6", "#eab308"}
+
+// PercentileValue is one row of the percentiles panel
+type PercentileValue struct {
+	Label  string  `json:"label"`
+	P      float64 `json:"p"`
+	Value  float64 `json:"value"`
+	Color  string  `json:"color"`
+	Marked bool    `json:"marked"`
+}
+
+// parsePercentiles parses a comma separated list like "50,90,99.9"
+func parsePercentiles(spec string) ([]float64, error) {
+	var rtn []float64
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "p")
+		if part == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(part, 64)
+		if err != nil || p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("invalid percentile %q (must be between 0 and 100)", part)
+		}
+		rtn = append(rtn, p)
+	}
+	return rtn, nil
+}
+
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// calcPercentiles evaluates ps against the sketch, unmarked holds the
+// labels whose marker is turned off
+func calcPercentiles(sketch *Sketch, ps []float64, unmarked map[string]bool) []PercentileValue {
+	var rtn []PercentileValue
+	for idx, p := range ps {
+		label := percentileLabel(p)
+		rtn = append(rtn, PercentileValue{
+			Label:  label,
+			P:      p,
+			Value:  sketch.Quantile(p / 100),
+			Color:  markerColors[idx%len(markerColors)],
+			Marked: !unmarked[label],
+		})
+	}
+	return rtn
+}
+
+// markerPosition returns the bucket v falls in and how far into the
+// bucket it is (0..1), measured in log space for log buckets
+func markerPosition(buckets []HistogramBucket, v float64, logScale bool) (int, float64) {
+	for idx, bucket := range buckets {
+		if v < bucket.End || idx == len(buckets)-1 {
+			if bucket.End <= bucket.Start {
+				return idx, 0
+			}
+			frac := (v - bucket.Start) / (bucket.End - bucket.Start)
+			if logScale && v > 0 && bucket.Start > 0 {
+				frac = math.Log(v/bucket.Start) / math.Log(bucket.End/bucket.Start)
+			}
+			return idx, min(max(frac, 0), 1)
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+)
+
+// seriesColors are cycled through for grouped series, the bars are drawn
+// semi-transparent so overlapping series stay visible
+var seriesColors = []string{"#3b82f6", "#22c55e", "#f97316", "#a855f7", "#06b6d4", "#ec4899", "#eab308", "#94a3b8"}
+
+// maxSeries limits the number of groups, later labels are lumped into
+// otherSeries
+const maxSeries = 8
+
+const otherSeries = "(other)"
+
+// Series is the sketch of one group of values (-group)
+type Series struct {
+	Label  string  `json:"label"`
+	Color  string  `json:"color"`
+	Sketch *Sketch `json:"sketch"`
+}
+
+// seriesCounts counts each series into the shared buckets
+func seriesCounts(series []Series, buckets []HistogramBucket, logScale bool, clip bool) [][]int {
+	if len(buckets) == 0 {
+		return nil
+	}
+	edges := make([]float64, 0, len(buckets)+1)
+	for _, bucket := range buckets {
+		edges = append(edges, bucket.Start)
+	}
+	edges = append(edges, buckets[len(buckets)-1].End)
+	rtn := make([][]int, len(series))
+	for idx, s := range series {
+		rtn[idx] = s.Sketch.BucketCounts(edges, logScale, clip)
+	}
+	return rtn
+}
+
+// seriesHeights scales the series counts like scaleHeights, against the
+// largest count of any series so the series are comparable
+func seriesHeights(counts [][]int, maxHeight int, logCounts bool) [][]int {
+	maxCount := 0
+	for _, row := range counts {
+		for _, count := range row {
+			maxCount = max(maxCount, count)
+		}
+	}
+	rtn := make([][]int, len(counts))
+	for idx, row := range counts {
+		rtn[idx] = make([]int, len(row))
+		if maxCount == 0 {
+			continue
+		}
+		for i, count := range row {
+			if logCounts {
+				rtn[idx][i] = int(math.Round(barFrac(count, maxCount, true) * float64(maxHeight)))
+			} else {
+				rtn[idx][i] = (count * maxHeight) / maxCount
+			}
+		}
+	}
+	return rtn
+}
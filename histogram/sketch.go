@@ -0,0 +1,271 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// linearBinCount is the resolution of the fine histogram the display
+// buckets are computed from
+const linearBinCount = 4096
+
+// linearBins is a fixed size histogram over a range that grows by doubling
+// the bin width (merging neighbouring bins), so memory is constant no
+// matter how many values are added. The first linearBinCount values are
+// kept as is to pick a bin width that fits the spread of the data.
+type linearBins struct {
+	Pending []float64 // values before the bins are laid out
+	Lo      float64
+	Width   float64 // always a power of two, keeps boundaries aligned when merging
+	Counts  []int64
+	prefix  []int64 // cumulative counts, built lazily for queries
+	sorted  bool    // Pending is sorted
+}
+
+func (lb *linearBins) add(v float64, n int64) {
+	lb.prefix = nil
+	if lb.Counts == nil {
+		if n == 1 && len(lb.Pending) < linearBinCount {
+			lb.Pending = append(lb.Pending, v)
+			lb.sorted = false
+			return
+		}
+		lb.layout(v)
+	}
+	lb.addBin(v, n)
+}
+
+// layout picks the bin width so the pending values span about a quarter
+// of the bins, leaving room to grow before the first merge
+func (lb *linearBins) layout(v float64) {
+	lo, hi := v, v
+	for _, p := range lb.Pending {
+		lo = math.Min(lo, p)
+		hi = math.Max(hi, p)
+	}
+	spread := (hi - lo) / (linearBinCount / 4)
+	if spread == 0 {
+		spread = math.Max(math.Abs(lo), 1) / linearBinCount
+	}
+	lb.Width = math.Ldexp(1, math.Ilogb(spread)+1)
+	span := lb.Width * linearBinCount
+	lb.Lo = math.Floor(lo/lb.Width)*lb.Width - span/8
+	lb.Lo = math.Floor(lb.Lo/lb.Width) * lb.Width
+	lb.Counts = make([]int64, linearBinCount)
+	pending := lb.Pending
+	lb.Pending = nil
+	for _, p := range pending {
+		lb.addBin(p, 1)
+	}
+}
+
+func (lb *linearBins) addBin(v float64, n int64) {
+	for v < lb.Lo {
+		lb.widenLeft()
+	}
+	for v >= lb.Lo+lb.Width*linearBinCount {
+		lb.widenRight()
+	}
+	idx := int((v - lb.Lo) / lb.Width)
+	idx = min(max(idx, 0), linearBinCount-1)
+	lb.Counts[idx] += n
+}
+
+// widenRight doubles the width keeping Lo, the bins move to the lower half
+func (lb *linearBins) widenRight() {
+	for i := 0; i < linearBinCount/2; i++ {
+		lb.Counts[i] = lb.Counts[2*i] + lb.Counts[2*i+1]
+	}
+	clear(lb.Counts[linearBinCount/2:])
+	lb.Width *= 2
+}
+
+// widenLeft doubles the width keeping the upper bound, the bins move to
+// the upper half
+func (lb *linearBins) widenLeft() {
+	for i := linearBinCount/2 - 1; i >= 0; i-- {
+		lb.Counts[linearBinCount/2+i] = lb.Counts[2*i] + lb.Counts[2*i+1]
+	}
+	clear(lb.Counts[:linearBinCount/2])
+	lb.Lo -= lb.Width * linearBinCount
+	lb.Width *= 2
+}
+
+// countBelow estimates the number of values < x, assuming values are
+// spread evenly inside a bin
+func (lb *linearBins) countBelow(x float64) float64 {
+	if lb.Counts == nil {
+		if !lb.sorted {
+			sort.Float64s(lb.Pending)
+			lb.sorted = true
+		}
+		return float64(sort.SearchFloat64s(lb.Pending, x))
+	}
+	if lb.prefix == nil {
+		lb.prefix = make([]int64, linearBinCount+1)
+		for i, c := range lb.Counts {
+			lb.prefix[i+1] = lb.prefix[i] + c
+		}
+	}
+	pos := (x - lb.Lo) / lb.Width
+	if pos <= 0 {
+		return 0
+	}
+	if pos >= linearBinCount {
+		return float64(lb.prefix[linearBinCount])
+	}
+	idx := int(pos)
+	return float64(lb.prefix[idx]) + float64(lb.Counts[idx])*(pos-float64(idx))
+}
+
+func (lb *linearBins) clone() linearBins {
+	rtn := linearBins{
+		Pending: append([]float64(nil), lb.Pending...),
+		Lo:      lb.Lo,
+		Width:   lb.Width,
+		sorted:  lb.sorted,
+	}
+	if lb.Counts != nil {
+		rtn.Counts = append([]int64(nil), lb.Counts...)
+	}
+	return rtn
+}
+
+// merge adds the values of other, a bin of other is added at its midpoint
+func (lb *linearBins) merge(other *linearBins) {
+	for _, p := range other.Pending {
+		lb.add(p, 1)
+	}
+	for i, c := range other.Counts {
+		if c > 0 {
+			lb.add(other.Lo+(float64(i)+0.5)*other.Width, c)
+		}
+	}
+}
+
+// Sketch summarizes a stream of values in constant memory: exact count,
+// min, max, mean and variance (Welford), a fine linear histogram for the
+// display buckets and a t-digest for quantiles.
+type Sketch struct {
+	Count  int64
+	Min    float64
+	Max    float64
+	mean   float64
+	m2     float64
+	bins   linearBins
+	digest *TDigest
+}
+
+func MakeSketch() *Sketch {
+	return &Sketch{
+		Min:    math.Inf(1),
+		Max:    math.Inf(-1),
+		digest: MakeTDigest(defaultCompression),
+	}
+}
+
+// Add records v, non-finite values are ignored
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	s.Count++
+	s.Min = math.Min(s.Min, v)
+	s.Max = math.Max(s.Max, v)
+	delta := v - s.mean
+	s.mean += delta / float64(s.Count)
+	s.m2 += delta * (v - s.mean)
+	s.bins.add(v, 1)
+	s.digest.Add(v, 1)
+}
+
+func (s *Sketch) Mean() float64 {
+	return s.mean
+}
+
+// StdDev is the population standard deviation
+func (s *Sketch) StdDev() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.Count))
+}
+
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.digest.Quantile(q)
+}
+
+// CountBelow estimates the number of values < x
+func (s *Sketch) CountBelow(x float64) float64 {
+	switch {
+	case s.Count == 0 || x <= s.Min:
+		return 0
+	case x > s.Max:
+		return float64(s.Count)
+	}
+	return math.Min(math.Max(s.bins.countBelow(x), 0), float64(s.Count))
+}
+
+func (s *Sketch) digestCountBelow(x float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.digest.CountBelow(x)
+}
+
+// BucketCounts returns the number of values in each bucket between
+// consecutive edges. Unless clip is set, values outside the edges are
+// counted in the first and last bucket. Log spaced edges use the t-digest,
+// its resolution is relative to the value where the linear bins would lump
+// small values.
+func (s *Sketch) BucketCounts(edges []float64, logScale bool, clip bool) []int {
+	if len(edges) < 2 {
+		return nil
+	}
+	countBelow := s.CountBelow
+	if logScale {
+		countBelow = s.digestCountBelow
+	}
+	rtn := make([]int, len(edges)-1)
+	prev := 0.0
+	if clip {
+		prev = countBelow(edges[0])
+	}
+	for i := range rtn {
+		below := float64(s.Count)
+		if i < len(rtn)-1 || (clip && edges[i+1] < s.Max) {
+			below = countBelow(edges[i+1])
+		}
+		rtn[i] = int(math.Round(below) - math.Round(prev))
+		prev = below
+	}
+	return rtn
+}
+
+// Merge adds the values summarized by other
+func (s *Sketch) Merge(other *Sketch) {
+	if other.Count == 0 {
+		return
+	}
+	total := s.Count + other.Count
+	delta := other.mean - s.mean
+	s.m2 += other.m2 + delta*delta*float64(s.Count)*float64(other.Count)/float64(total)
+	s.mean += delta * float64(other.Count) / float64(total)
+	s.Count = total
+	s.Min = math.Min(s.Min, other.Min)
+	s.Max = math.Max(s.Max, other.Max)
+	s.bins.merge(&other.bins)
+	s.digest.Merge(other.digest)
+}
+
+// Clone returns an independent copy, used to render while values keep
+// coming in
+func (s *Sketch) Clone() *Sketch {
+	rtn := *s
+	rtn.bins = s.bins.clone()
+	rtn.digest = s.digest.Clone()
+	return &rtn
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSketchStats(t *testing.T) {
+	s := MakeSketch()
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		s.Add(v)
+	}
+	if s.Count != 8 || s.Min != 2 || s.Max != 9 {
+		t.Errorf("count/min/max: got %d/%v/%v, want 8/2/9", s.Count, s.Min, s.Max)
+	}
+	if s.Mean() != 5 {
+		t.Errorf("mean: got %v, want 5", s.Mean())
+	}
+	if s.StdDev() != 2 {
+		t.Errorf("stddev: got %v, want 2", s.StdDev())
+	}
+	if got := s.Quantile(0.5); got != 4.5 {
+		t.Errorf("median: got %v, want 4.5", got)
+	}
+}
+
+func TestSketchIgnoresNonFinite(t *testing.T) {
+	s := MakeSketch()
+	for _, v := range []float64{1, math.NaN(), math.Inf(1), math.Inf(-1), 3} {
+		s.Add(v)
+	}
+	if s.Count != 2 || s.Min != 1 || s.Max != 3 || s.Mean() != 2 {
+		t.Errorf("got count %d, min %v, max %v, mean %v", s.Count, s.Min, s.Max, s.Mean())
+	}
+	if got := s.Quantile(1); got != 3 {
+		t.Errorf("max quantile: got %v, want 3", got)
+	}
+}
+
+func TestSketchEmpty(t *testing.T) {
+	s := MakeSketch()
+	if s.Quantile(0.5) != 0 || s.StdDev() != 0 || s.CountBelow(1) != 0 {
+		t.Errorf("empty sketch: quantile %v, stddev %v", s.Quantile(0.5), s.StdDev())
+	}
+}
+
+func TestLinearBinsWiden(t *testing.T) {
+	s := MakeSketch()
+	// the first values lay out the bins over 0..1
+	for i := 0; i < linearBinCount; i++ {
+		s.Add(float64(i) / linearBinCount)
+	}
+	s.Add(0.5)
+	if s.bins.Counts == nil {
+		t.Fatal("bins not laid out")
+	}
+	width := s.bins.Width
+	// far outside on both sides, the bins double until they fit
+	s.Add(1000)
+	s.Add(-1000)
+	if s.bins.Width <= width {
+		t.Errorf("width %v did not grow from %v", s.bins.Width, width)
+	}
+	if s.bins.Lo > -1000 || s.bins.Lo+s.bins.Width*linearBinCount <= 1000 {
+		t.Errorf("range %v..%v does not hold -1000..1000", s.bins.Lo, s.bins.Lo+s.bins.Width*linearBinCount)
+	}
+	var total int64
+	for _, c := range s.bins.Counts {
+		total += c
+	}
+	if total != s.Count {
+		t.Errorf("bins hold %d values, want %d", total, s.Count)
+	}
+	// everything but -1000 is >= 0
+	if got := s.CountBelow(0); math.Abs(got-1) > 1 {
+		t.Errorf("CountBelow(0) = %v, want about 1", got)
+	}
+}
+
+func TestBucketCounts(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	s := MakeSketch()
+	for i := 0; i < 10000; i++ {
+		s.Add(rng.Float64() * 100)
+	}
+	edges := []float64{0, 25, 50, 75, 100}
+	counts := s.BucketCounts(edges, false, false)
+	sum := 0
+	for _, c := range counts {
+		sum += c
+		if math.Abs(float64(c)-2500) > 150 {
+			t.Errorf("bucket count %d, want about 2500", c)
+		}
+	}
+	if sum != 10000 {
+		t.Errorf("buckets hold %d values, want 10000", sum)
+	}
+	// without clip, values outside the edges go to the outer buckets
+	counts = s.BucketCounts([]float64{40, 60}, false, false)
+	if len(counts) != 1 || counts[0] != 10000 {
+		t.Errorf("unclipped: got %v, want [10000]", counts)
+	}
+	counts = s.BucketCounts([]float64{40, 60}, false, true)
+	if len(counts) != 1 || math.Abs(float64(counts[0])-2000) > 150 {
+		t.Errorf("clipped: got %v, want about [2000]", counts)
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	a := MakeSketch()
+	b := MakeSketch()
+	all := MakeSketch()
+	for i := 0; i < 6000; i++ {
+		v := float64(i)
+		all.Add(v)
+		if i < 2000 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(b)
+	if a.Count != all.Count || a.Min != all.Min || a.Max != all.Max {
+		t.Errorf("got count %d min %v max %v, want %d %v %v", a.Count, a.Min, a.Max, all.Count, all.Min, all.Max)
+	}
+	if math.Abs(a.Mean()-all.Mean()) > 1e-9 || math.Abs(a.StdDev()-all.StdDev()) > 1e-6 {
+		t.Errorf("got mean %v stddev %v, want %v %v", a.Mean(), a.StdDev(), all.Mean(), all.StdDev())
+	}
+	if got := a.Quantile(0.5); math.Abs(got-3000) > 60 {
+		t.Errorf("median %v, want about 3000", got)
+	}
+	if got := a.CountBelow(3000); math.Abs(got-3000) > 60 {
+		t.Errorf("CountBelow(3000) = %v, want about 3000", got)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// TDigest is a merging t-digest (Dunning) for streaming quantile estimates.
+// Memory is bounded by the compression (about compression centroids) and
+// accuracy is best in the tails, which is where latency percentiles live.
+type TDigest struct {
+	Compression float64
+	centroids   []centroid // sorted by mean, already merged
+	buffer      []centroid // unmerged additions
+	total       float64
+	min         float64
+	max         float64
+}
+
+type centroid struct {
+	Mean  float64
+	Count float64
+}
+
+const defaultCompression = 200
+
+func MakeTDigest(compression float64) *TDigest {
+	return &TDigest{
+		Compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (td *TDigest) Add(v float64, count float64) {
+	td.buffer = append(td.buffer, centroid{Mean: v, Count: count})
+	td.total += count
+	td.min = math.Min(td.min, v)
+	td.max = math.Max(td.max, v)
+	if len(td.buffer) >= int(td.Compression)*5 {
+		td.compress()
+	}
+}
+
+// kScale is the k1 scale function, it keeps centroids small near q=0 and q=1
+func (td *TDigest) kScale(q float64) float64 {
+	return td.Compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (td *TDigest) kScaleInv(k float64) float64 {
+	return (math.Sin(k*2*math.Pi/td.Compression) + 1) / 2
+}
+
+// compress merges the buffer into the centroids
+func (td *TDigest) compress() {
+	if len(td.buffer) == 0 {
+		return
+	}
+	all := append(td.centroids, td.buffer...)
+	td.buffer = nil
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Mean < all[j].Mean
+	})
+	merged := make([]centroid, 0, len(td.centroids)+1)
+	cur := all[0]
+	soFar := 0.0
+	qLimit := td.kScaleInv(td.kScale(0) + 1)
+	for _, next := range all[1:] {
+		if (soFar+cur.Count+next.Count)/td.total <= qLimit {
+			cur.Count += next.Count
+			cur.Mean += (next.Mean - cur.Mean) * next.Count / cur.Count
+			continue
+		}
+		merged = append(merged, cur)
+		soFar += cur.Count
+		qLimit = td.kScaleInv(td.kScale(soFar/td.total) + 1)
+		cur = next
+	}
+	td.centroids = append(merged, cur)
+}
+
+func (td *TDigest) Count() float64 {
+	return td.total
+}
+
+// singletons reports whether no centroid holds more than one value
+func (td *TDigest) singletons() bool {
+	for _, c := range td.centroids {
+		if c.Count != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Quantile returns the estimated value at q (0..1), NaN if empty
+func (td *TDigest) Quantile(q float64) float64 {
+	td.compress()
+	cs := td.centroids
+	if len(cs) == 0 {
+		return math.NaN()
+	}
+	if len(cs) == 1 {
+		return cs[0].Mean
+	}
+	if td.singletons() {
+		// small streams: every centroid is one value, interpolate between
+		// the values themselves
+		pos := q * float64(len(cs)-1)
+		idx := min(int(pos), len(cs)-2)
+		return cs[idx].Mean + (pos-float64(idx))*(cs[idx+1].Mean-cs[idx].Mean)
+	}
+	index := q * td.total
+	if index < 1 {
+		return td.min
+	}
+	if index >= td.total-1 {
+		return td.max
+	}
+	first := cs[0]
+	if first.Count > 2 && index < first.Count/2 {
+		return td.min + (index-1)/(first.Count/2-1)*(first.Mean-td.min)
+	}
+	weightSoFar := first.Count / 2
+	for i := 0; i < len(cs)-1; i++ {
+		dw := (cs[i].Count + cs[i+1].Count) / 2
+		if weightSoFar+dw > index {
+			z1 := index - weightSoFar
+			z2 := weightSoFar + dw - index
+			return (cs[i].Mean*z2 + cs[i+1].Mean*z1) / (z1 + z2)
+		}
+		weightSoFar += dw
+	}
+	last := cs[len(cs)-1]
+	remaining := td.total - index
+	if last.Count <= 2 || remaining >= last.Count/2 {
+		return last.Mean
+	}
+	return td.max - (remaining-1)/(last.Count/2-1)*(td.max-last.Mean)
+}
+
+// CountBelow returns the estimated number of values < x
+func (td *TDigest) CountBelow(x float64) float64 {
+	td.compress()
+	cs := td.centroids
+	switch {
+	case len(cs) == 0 || x <= td.min:
+		return 0
+	case x > td.max:
+		return td.total
+	case len(cs) == 1 || td.max == td.min:
+		return td.total * (x - td.min) / (td.max - td.min)
+	}
+	first := cs[0]
+	if x < first.Mean {
+		return first.Count / 2 * (x - td.min) / (first.Mean - td.min)
+	}
+	weightSoFar := first.Count / 2
+	for i := 0; i < len(cs)-1; i++ {
+		dw := (cs[i].Count + cs[i+1].Count) / 2
+		if x < cs[i+1].Mean {
+			return weightSoFar + dw*(x-cs[i].Mean)/(cs[i+1].Mean-cs[i].Mean)
+		}
+		weightSoFar += dw
+	}
+	last := cs[len(cs)-1]
+	if td.max == last.Mean {
+		return td.total
+	}
+	return weightSoFar + last.Count/2*(x-last.Mean)/(td.max-last.Mean)
+}
+
+// Merge adds the centroids of other
+func (td *TDigest) Merge(other *TDigest) {
+	other.compress()
+	for _, c := range other.centroids {
+		td.buffer = append(td.buffer, c)
+		td.total += c.Count
+	}
+	td.min = math.Min(td.min, other.min)
+	td.max = math.Max(td.max, other.max)
+	td.compress()
+}
+
+func (td *TDigest) Clone() *TDigest {
+	td.compress()
+	rtn := *td
+	rtn.centroids = append([]centroid(nil), td.centroids...)
+	return &rtn
+}
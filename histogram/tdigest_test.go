@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTDigestSmall(t *testing.T) {
+	tests := []struct {
+		values []float64
+		q      float64
+		want   float64
+	}{
+		{[]float64{5}, 0.5, 5},
+		{[]float64{1, 2}, 0, 1},
+		{[]float64{1, 2}, 0.5, 1.5},
+		{[]float64{1, 2}, 1, 2},
+		{[]float64{3, 1, 2}, 0.5, 2},
+		{[]float64{1, 2, 3, 4}, 0.5, 2.5},
+		{[]float64{1, 2, 3, 4, 5}, 0.25, 2},
+		{[]float64{1, 2, 3, 4, 5}, 0.9, 4.6},
+		{[]float64{7, 7, 7}, 0.5, 7},
+	}
+	for _, tt := range tests {
+		td := MakeTDigest(defaultCompression)
+		for _, v := range tt.values {
+			td.Add(v, 1)
+		}
+		if got := td.Quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%v: Quantile(%v) = %v, want %v", tt.values, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestTDigestEmpty(t *testing.T) {
+	if got := MakeTDigest(defaultCompression).Quantile(0.5); !math.IsNaN(got) {
+		t.Errorf("got %v, want NaN", got)
+	}
+}
+
+// exactQuantile interpolates between the sorted values, like the digest
+// does for small streams
+func exactQuantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	idx := min(int(pos), len(sorted)-2)
+	return sorted[idx] + (pos-float64(idx))*(sorted[idx+1]-sorted[idx])
+}
+
+func TestTDigestAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]float64, 100000)
+	td := MakeTDigest(defaultCompression)
+	for i := range values {
+		// log-normal, a typical latency distribution
+		values[i] = math.Exp(rng.NormFloat64())
+		td.Add(values[i], 1)
+	}
+	sort.Float64s(values)
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+		got := td.Quantile(q)
+		// compare ranks, the error of a t-digest is bounded in q
+		rank := float64(sort.SearchFloat64s(values, got)) / float64(len(values))
+		maxErr := 0.01 * math.Max(4*q*(1-q), 0.05)
+		if math.Abs(rank-q) > maxErr {
+			t.Errorf("Quantile(%v) = %v (exact %v) is at rank %v", q, got, exactQuantile(values, q), rank)
+		}
+	}
+	if got := td.Quantile(0); got != values[0] {
+		t.Errorf("Quantile(0) = %v, want the min %v", got, values[0])
+	}
+	if got := td.Quantile(1); got != values[len(values)-1] {
+		t.Errorf("Quantile(1) = %v, want the max %v", got, values[len(values)-1])
+	}
+	if len(td.centroids) > 2*defaultCompression {
+		t.Errorf("%d centroids, want at most %d", len(td.centroids), 2*defaultCompression)
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	a := MakeTDigest(defaultCompression)
+	b := MakeTDigest(defaultCompression)
+	for i := 0; i < 10000; i++ {
+		a.Add(rng.Float64()*1000, 1)
+		b.Add(1000+rng.Float64()*1000, 1)
+	}
+	a.Merge(b)
+	if a.Count() != 20000 {
+		t.Fatalf("merged count %v, want 20000", a.Count())
+	}
+	for _, q := range []float64{0.1, 0.25, 0.5, 0.75, 0.9} {
+		// uniform over 0..2000
+		if got, want := a.Quantile(q), q*2000; math.Abs(got-want) > 20 {
+			t.Errorf("Quantile(%v) = %v, want about %v", q, got, want)
+		}
+	}
+}
+
+func TestTDigestClone(t *testing.T) {
+	td := MakeTDigest(defaultCompression)
+	td.Add(1, 1)
+	td.Add(2, 1)
+	clone := td.Clone()
+	td.Add(100, 1)
+	if got := clone.Quantile(1); got != 2 {
+		t.Errorf("clone changed with the original, max %v", got)
+	}
+}
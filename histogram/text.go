@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// textBarWidth is the width of the longest bar in -text mode, in cells
+const textBarWidth = 50
+
+// blockEighths are the partial blocks, a cell is split into 8 steps
+var blockEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// textBar draws a bar of frac*width cells with Unicode block elements
+func textBar(frac float64, width int) string {
+	eighths := int(math.Round(frac * float64(width) * 8))
+	bar := strings.Repeat("█", eighths/8) + blockEighths[eighths%8]
+	if eighths == 0 && frac > 0 {
+		// keep non-empty buckets visible
+		bar = blockEighths[1]
+	}
+	return bar
+}
+
+// renderText writes the histogram as text, for -text and CI logs. It uses
+// the same buckets as the Wave view.
+func renderText(w io.Writer, sketch *Sketch, series []Series, status IngestStatus, opts BucketOpts, logCounts bool) {
+	unit := status.Unit
+	if sketch.Count == 0 {
+		fmt.Fprintln(w, "no values")
+	} else {
+		fmt.Fprintf(w, "Count: %d | Range: %s - %s | Mean: %s | Median: %s | StdDev: %s\n",
+			sketch.Count, unit.Format(sketch.Min), unit.Format(sketch.Max),
+			unit.Format(sketch.Mean()), unit.Format(sketch.Quantile(0.5)), unit.Format(sketch.StdDev()))
+	}
+	if windowSpec.IsSet() {
+		fmt.Fprintf(w, "Window: %s\n", windowSpec.Label())
+	}
+	// also without values, they tell why there are none
+	if status.Skipped > 0 {
+		fmt.Fprintf(w, "Skipped: %d lines (last: %q)\n", status.Skipped, status.LastSkipped)
+	}
+	if status.NonFinite > 0 {
+		fmt.Fprintf(w, "NaN/Inf: %d values, not counted\n", status.NonFinite)
+	}
+	if status.Rejected > 0 {
+		fmt.Fprintf(w, "Mixed units: %d value(s) rejected, the stream is %s but got %q\n", status.Rejected, unit.Name(), status.LastRejected)
+	}
+	if sketch.Count == 0 {
+		return
+	}
+
+	buckets, warning := makeBuckets(sketch, opts)
+	if warning != "" {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	counts := seriesCounts(series, buckets, opts.LogScale && warning == "", opts.Clip)
+	// bars are scaled from the counts, the rounded heights would hide
+	// small buckets
+	maxCount := 0
+	for _, bucket := range buckets {
+		maxCount = max(maxCount, bucket.Count)
+	}
+	if len(series) > 0 {
+		maxCount = 0
+		for _, row := range counts {
+			for _, count := range row {
+				maxCount = max(maxCount, count)
+			}
+		}
+	}
+
+	// Right align the bucket ranges
+	ranges := make([]string, len(buckets))
+	rangeWidth := 0
+	for idx, bucket := range buckets {
+		ranges[idx] = unit.FormatEdge(bucket.Start) + " - " + unit.FormatEdge(bucket.End)
+		rangeWidth = max(rangeWidth, len([]rune(ranges[idx])))
+	}
+	labelWidth := 0
+	for _, s := range series {
+		labelWidth = max(labelWidth, len([]rune(s.Label)))
+	}
+
+	fmt.Fprintln(w)
+	for idx, bucket := range buckets {
+		pad := strings.Repeat(" ", rangeWidth-len([]rune(ranges[idx])))
+		if len(series) == 0 {
+			fmt.Fprintf(w, "%s%s │%s %d\n", pad, ranges[idx], textBar(barFrac(bucket.Count, maxCount, logCounts), textBarWidth), bucket.Count)
+			continue
+		}
+		for i, s := range series {
+			rangeText := pad + ranges[idx]
+			if i > 0 {
+				rangeText = strings.Repeat(" ", rangeWidth)
+			}
+			fmt.Fprintf(w, "%s %-*s │%s %d\n", rangeText, labelWidth, s.Label, textBar(barFrac(counts[i][idx], maxCount, logCounts), textBarWidth), counts[i][idx])
+		}
+	}
+
+	if len(percentiles) > 0 {
+		fmt.Fprintln(w)
+		var parts []string
+		for _, pv := range calcPercentiles(sketch, percentiles, nil) {
+			parts = append(parts, pv.Label+": "+unit.Format(pv.Value))
+		}
+		fmt.Fprintln(w, strings.Join(parts, " | "))
+	}
+	for _, s := range series {
+		var parts []string
+		for _, pv := range calcPercentiles(s.Sketch, percentiles, nil) {
+			parts = append(parts, pv.Label+": "+unit.Format(pv.Value))
+		}
+		fmt.Fprintf(w, "%-*s count: %d | mean: %s | %s\n", labelWidth, s.Label, s.Sketch.Count, unit.Format(s.Sketch.Mean()), strings.Join(parts, " | "))
+	}
+}
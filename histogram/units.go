@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DimNone     = ""
+	DimDuration = "duration" // base unit: seconds
+	DimBytes    = "bytes"    // base unit: bytes
+)
+
+// ValueUnit is the kind of values in the stream, taken from the first value
+type ValueUnit struct {
+	Dim    string `json:"dim"`
+	Binary bool   `json:"binary"` // sizes were given as KiB/MiB/..., display them that way
+}
+
+type unitScale struct {
+	Name  string
+	Scale float64
+}
+
+var durationUnits = map[string]float64{
+	"ns": 1e-9, "us": 1e-6, "µs": 1e-6, "μs": 1e-6, "ms": 1e-3,
+	"s": 1, "sec": 1, "m": 60, "min": 60, "h": 3600, "hr": 3600,
+}
+
+// byteUnits is matched case insensitively
+var byteUnits = map[string]float64{
+	"b": 1, "kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12, "pb": 1e15,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40, "pib": 1 << 50,
+}
+
+// display units, smallest first
+var (
+	durationDisplay = []unitScale{{"ns", 1e-9}, {"µs", 1e-6}, {"ms", 1e-3}, {"s", 1}, {"min", 60}, {"h", 3600}}
+	byteDisplaySI   = []unitScale{{"B", 1}, {"kB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"PB", 1e15}}
+	byteDisplayIEC  = []unitScale{{"B", 1}, {"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40}, {"PiB", 1 << 50}}
+)
+
+var unitValueRe = regexp.MustCompile(`^([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*([a-zA-Zµμ]+)$`)
+
+// parseValue parses a number with an optional unit suffix and normalizes
+// it to the base unit of its dimension
+func parseValue(text string) (float64, ValueUnit, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, ValueUnit{}, false
+	}
+	if num, err := strconv.ParseFloat(text, 64); err == nil {
+		return num, ValueUnit{}, true
+	}
+	if match := unitValueRe.FindStringSubmatch(text); match != nil {
+		num, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, ValueUnit{}, false
+		}
+		if scale, ok := durationUnits[match[2]]; ok {
+			return num * scale, ValueUnit{Dim: DimDuration}, true
+		}
+		lower := strings.ToLower(match[2])
+		if scale, ok := byteUnits[lower]; ok {
+			return num * scale, ValueUnit{Dim: DimBytes, Binary: strings.HasSuffix(lower, "ib")}, true
+		}
+		return 0, ValueUnit{}, false
+	}
+	// compound durations like 1h30m
+	if d, err := time.ParseDuration(text); err == nil {
+		return d.Seconds(), ValueUnit{Dim: DimDuration}, true
+	}
+	return 0, ValueUnit{}, false
+}
+
+// accepts reports whether a value parsed as num with unit other belongs in
+// a stream of u. A unitless 0 is zero in any unit.
+func (u ValueUnit) accepts(num float64, other ValueUnit) bool {
+	return other.Dim == u.Dim || (num == 0 && other.Dim == DimNone)
+}
+
+func (u ValueUnit) displayUnits() []unitScale {
+	switch {
+	case u.Dim == DimDuration:
+		return durationDisplay
+	case u.Dim == DimBytes && u.Binary:
+		return byteDisplayIEC
+	case u.Dim == DimBytes:
+		return byteDisplaySI
+	}
+	return nil
+}
+
+// Name describes the dimension for messages
+func (u ValueUnit) Name() string {
+	if u.Dim == DimNone {
+		return "plain numbers"
+	}
+	return u.Dim
+}
+
+// trimNumber formats v with about 3 significant digits
+func trimNumber(v float64) string {
+	prec := 2
+	switch abs := math.Abs(v); {
+	case abs >= 100:
+		prec = 0
+	case abs >= 10:
+		prec = 1
+	}
+	rtn := strconv.FormatFloat(v, 'f', prec, 64)
+	if strings.Contains(rtn, ".") {
+		rtn = strings.TrimRight(strings.TrimRight(rtn, "0"), ".")
+	}
+	return rtn
+}
+
+// scaled formats v (in base units) in the largest display unit it reaches
+func (u ValueUnit) scaled(v float64) string {
+	units := u.displayUnits()
+	pick := units[0]
+	if v == 0 && u.Dim == DimDuration {
+		pick = unitScale{"s", 1}
+	}
+	for _, unit := range units {
+		if math.Abs(v) >= unit.Scale {
+			pick = unit
+		}
+	}
+	return trimNumber(v/pick.Scale) + pick.Name
+}
+
+// Format formats a statistic (mean, percentile, ...)
+func (u ValueUnit) Format(v float64) string {
+	if u.Dim == DimNone {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	return u.scaled(v)
+}
+
+// FormatEdge formats a bucket boundary for the axis
+func (u ValueUnit) FormatEdge(v float64) string {
+	if u.Dim == DimNone {
+		return formatEdge(v)
+	}
+	return u.scaled(v)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowPanes is how many panes a window is split into. Sketches cannot
+// forget single values, so the window advances by dropping its oldest
+// pane, i.e. in steps of a tenth of its span. A count window therefore
+// holds up to a pane more than its Count (see Label).
+const windowPanes = 10
+
+// WindowSpec is the -window option, the last Count values or the values
+// of the last Span (at most one is set)
+type WindowSpec struct {
+	Count int64         `json:"count"`
+	Span  time.Duration `json:"span"`
+}
+
+// parseWindow parses "1000" (values) or a duration like "60s" or "5m"
+func parseWindow(spec string) (WindowSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return WindowSpec{}, nil
+	}
+	if count, err := strconv.ParseInt(spec, 10, 64); err == nil {
+		if count < windowPanes {
+			return WindowSpec{}, fmt.Errorf("-window must be at least %d values", windowPanes)
+		}
+		return WindowSpec{Count: count}, nil
+	}
+	span, err := time.ParseDuration(spec)
+	if err != nil || span < time.Second {
+		return WindowSpec{}, fmt.Errorf("invalid -window %q (a number of values or a duration of at least 1s, like 60s)", spec)
+	}
+	return WindowSpec{Span: span}, nil
+}
+
+func (w WindowSpec) IsSet() bool {
+	return w.Count > 0 || w.Span > 0
+}
+
+// Label describes the window for the header, a count window is given as
+// the range of values it holds
+func (w WindowSpec) Label() string {
+	if w.Count > 0 {
+		return fmt.Sprintf("last %d-%d values", w.Count, w.Count+w.paneCount())
+	}
+	return "last " + w.Span.String()
+}
+
+// sketchPane holds the values of one slice of the window, or all values
+// without a window
+type sketchPane struct {
+	Start  time.Time
+	Sketch *Sketch
+	Groups map[string]*Sketch
+}
+
+func makeSketchPane(start time.Time) *sketchPane {
+	return &sketchPane{
+		Start:  start,
+		Sketch: MakeSketch(),
+		Groups: make(map[string]*Sketch),
+	}
+}
+
+func (pane *sketchPane) group(label string) *Sketch {
+	sketch, ok := pane.Groups[label]
+	if !ok {
+		sketch = MakeSketch()
+		pane.Groups[label] = sketch
+	}
+	return sketch
+}
+
+// full reports whether the pane covers its share of the window
+func (pane *sketchPane) full(window WindowSpec, now time.Time) bool {
+	switch {
+	case window.Count > 0:
+		return pane.Sketch.Count >= window.paneCount()
+	case window.Span > 0:
+		return now.Sub(pane.Start) >= window.Span/windowPanes
+	}
+	return false
+}
+
+// paneCount is the number of values in a full pane of a count window
+func (w WindowSpec) paneCount() int64 {
+	return (w.Count + windowPanes - 1) / windowPanes
+}
+
+// expirePanes drops the panes that fell out of the window. A count window
+// keeps at least Count values and at most a pane more, a time
+// window drops the panes that ended before now-Span.
+func expirePanes(panes []*sketchPane, window WindowSpec, now time.Time) []*sketchPane {
+	switch {
+	case window.Count > 0:
+		var total int64
+		for _, pane := range panes {
+			total += pane.Sketch.Count
+		}
+		for len(panes) > 1 && total-panes[0].Sketch.Count >= window.Count {
+			total -= panes[0].Sketch.Count
+			panes = panes[1:]
+		}
+	case window.Span > 0:
+		paneSpan := window.Span / windowPanes
+		for len(panes) > 0 && now.Sub(panes[0].Start) >= window.Span+paneSpan {
+			panes = panes[1:]
+		}
+	}
+	return panes
+}
+
+// mergePanes combines the sketches of the panes, getSketch picks the
+// sketch of a pane (nil if the pane has none)
+func mergePanes(panes []*sketchPane, getSketch func(*sketchPane) *Sketch) *Sketch {
+	var rtn *Sketch
+	for _, pane := range panes {
+		sketch := getSketch(pane)
+		switch {
+		case sketch == nil:
+		case rtn == nil:
+			rtn = sketch.Clone()
+		default:
+			rtn.Merge(sketch)
+		}
+	}
+	return rtn
+}
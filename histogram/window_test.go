@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountWindow(t *testing.T) {
+	window, err := parseWindow("1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := window.Label(), "last 1000-1100 values"; got != want {
+		t.Errorf("label: got %q, want %q", got, want)
+	}
+	store := MakeSketchStore(window)
+	minCount, maxCount := int64(-1), int64(0)
+	for i := 0; i < 5000; i++ {
+		store.AddBatch([]float64{float64(i)}, nil, ingestDelta{})
+		if i < 999 {
+			continue
+		}
+		var count int64
+		for _, pane := range store.Panes {
+			count += pane.Sketch.Count
+		}
+		if minCount < 0 || count < minCount {
+			minCount = count
+		}
+		maxCount = max(maxCount, count)
+	}
+	if minCount != 1000 || maxCount != 1100 {
+		t.Errorf("window held %d to %d values, want 1000 to 1100", minCount, maxCount)
+	}
+}
+
+func TestTimeWindowExpire(t *testing.T) {
+	window := WindowSpec{Span: 10 * time.Second}
+	start := time.Now()
+	var panes []*sketchPane
+	for sec := 0; sec < 30; sec++ {
+		panes = append(panes, makeSketchPane(start.Add(time.Duration(sec)*time.Second)))
+	}
+	now := start.Add(30 * time.Second)
+	panes = expirePanes(panes, window, now)
+	// panes that started 11s ago or earlier ended before now-10s
+	if got := now.Sub(panes[0].Start); got != 10*time.Second {
+		t.Errorf("oldest pane started %v ago, want 10s", got)
+	}
+}
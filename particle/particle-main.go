@@ -4,12 +4,12 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"math"
 	"math/rand"
 	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/vdom"
 	"github.com/wavetermdev/waveterm/pkg/waveapp"
+	"waveapps/canvas"
 )
 
 var AppClient *waveapp.Client = waveapp.MakeClient(waveapp.AppOpts{
@@ -49,29 +49,12 @@ var CanvasUpdaterParticles = waveapp.DefineComponent[CanvasUpdaterProps](AppClie
 			setParticles(newParticles)
 
 			// Drawing operations on canvas
-			vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-				Op:     "clearRect",
-				Params: []any{0, 0, 300, 300},
-			})
-
+			c := canvas.New()
+			c.ClearRect(0, 0, 300, 300)
 			for _, particle := range newParticles {
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "fillStyle",
-					Params: []any{particle.Color},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "beginPath",
-					Params: []any{},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "arc",
-					Params: []any{particle.X, particle.Y, particle.Size, 0, 2 * math.Pi},
-				})
-				vdom.QueueRefOp(ctx, canvasRef, vdom.VDomRefOperation{
-					Op:     "fill",
-					Params: []any{},
-				})
+				c.FillStyle(particle.Color).Circle(particle.X, particle.Y, particle.Size)
 			}
+			c.Flush(ctx, canvasRef)
 
 			// Trigger re-render based on tickNum, not particles
 			go func() {